@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
+)
+
+// Flag describes one option of a command. Names include their dashes, so a
+// flag can be spelled "-m" and "--message". Flags with a Value placeholder
+// take an argument, either as the next word, as "--name=value" or, for
+// single letter flags, glued on as "-mvalue". With OptionalValue set the
+// argument can only be given as "--name=value" and may be left out.
+type Flag struct {
+	Names         []string
+	Value         string
+	OptionalValue bool
+	Help          string
+}
+
+// Command is one subcommand of the CLI.
+type Command struct {
+	Name    string
+	Usage   []string
+	Flags   []Flag
+	MinArgs int
+	// MaxArgs is the largest number of positional arguments, or -1 for no
+	// limit.
+	MaxArgs int
+	Run     func(repo *repository.Repository, options *Options) error
+}
+
+// Options holds the parsed flags and positional arguments of a command
+// line. Flag values are keyed by the first name of their Flag.
+type Options struct {
+	values map[string][]string
+	Args   []string
+}
+
+func (o *Options) Bool(name string) bool {
+	return len(o.values[name]) > 0
+}
+
+// String returns the last value given for name, so later flags override
+// earlier ones.
+func (o *Options) String(name string) string {
+	values := o.values[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+func (o *Options) Strings(name string) []string {
+	return o.values[name]
+}
+
+var errHelp = errors.New("help requested")
+
+func (c *Command) usageText() string {
+	text := strings.Builder{}
+	for i, usage := range c.Usage {
+		if i == 0 {
+			fmt.Fprintf(&text, "usage: git %s\n", usage)
+		} else {
+			fmt.Fprintf(&text, "   or: git %s\n", usage)
+		}
+	}
+	if len(c.Flags) > 0 {
+		text.WriteString("\n")
+	}
+	for _, flag := range c.Flags {
+		names := strings.Join(flag.Names, ", ")
+		if flag.OptionalValue {
+			names += "[=<" + flag.Value + ">]"
+		} else if flag.Value != "" {
+			names += " <" + flag.Value + ">"
+		}
+		fmt.Fprintf(&text, "    %-26s%s\n", names, flag.Help)
+	}
+	return text.String()
+}
+
+func (c *Command) usageError(format string, args ...any) error {
+	return &UsageError{
+		Message: fmt.Sprintf(format, args...),
+		Usage:   c.usageText(),
+	}
+}
+
+func (c *Command) findFlag(name string) *Flag {
+	for i := range c.Flags {
+		for _, flagName := range c.Flags[i].Names {
+			if flagName == name {
+				return &c.Flags[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Parse splits args into flags and positional arguments. Flags may appear
+// anywhere before a "--"; everything after it is positional.
+func (c *Command) Parse(args []string) (*Options, error) {
+	options := &Options{values: map[string][]string{}}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			options.Args = append(options.Args, args[i+1:]...)
+			break
+		}
+		if arg == "-h" || arg == "--help" {
+			return nil, errHelp
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			options.Args = append(options.Args, arg)
+			continue
+		}
+
+		name, value, hasValue := arg, "", false
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue = strings.Cut(arg, "=")
+		} else if len(arg) > 2 {
+			name, value, hasValue = arg[:2], arg[2:], true
+		}
+
+		flag := c.findFlag(name)
+		if flag == nil {
+			return nil, c.usageError("unknown option '%s'", strings.TrimLeft(name, "-"))
+		}
+
+		if flag.Value == "" {
+			if hasValue && strings.HasPrefix(name, "--") {
+				return nil, c.usageError("option '%s' takes no value", strings.TrimLeft(name, "-"))
+			}
+			options.values[flag.Names[0]] = append(options.values[flag.Names[0]], "true")
+			if hasValue {
+				// Bundled single letter flags such as -qv.
+				args = append(args[:i+1], append([]string{"-" + value}, args[i+1:]...)...)
+			}
+			continue
+		}
+
+		if !hasValue && flag.OptionalValue {
+			options.values[flag.Names[0]] = append(options.values[flag.Names[0]], "")
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, c.usageError("option '%s' requires a value", strings.TrimLeft(name, "-"))
+			}
+			i++
+			value = args[i]
+		}
+		options.values[flag.Names[0]] = append(options.values[flag.Names[0]], value)
+	}
+
+	if len(options.Args) < c.MinArgs || (c.MaxArgs >= 0 && len(options.Args) > c.MaxArgs) {
+		return nil, c.usageError("wrong number of arguments")
+	}
+	return options, nil
+}
+
+func findCommand(name string) *Command {
+	for _, command := range commands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+func printCommands() {
+	fmt.Println("usage: ./your_program.sh <command> [<args>...]")
+	fmt.Println()
+	fmt.Println("These are the available commands:")
+	for _, command := range commands {
+		fmt.Printf("   %s\n", command.Usage[0])
+	}
+	fmt.Println()
+	fmt.Println("Run './your_program.sh <command> -h' for the options of a command.")
+}
+
+func run(name string, args []string) error {
+	if name == "help" || name == "-h" || name == "--help" {
+		if len(args) > 0 && findCommand(args[0]) != nil {
+			fmt.Print(findCommand(args[0]).usageText())
+			return nil
+		}
+		printCommands()
+		return nil
+	}
+
+	command := findCommand(name)
+	if command == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n", name)
+		return &ExitError{Code: EXIT_NEGATIVE}
+	}
+
+	options, err := command.Parse(args)
+	if errors.Is(err, errHelp) {
+		fmt.Print(command.usageText())
+		return &ExitError{Code: EXIT_USAGE}
+	}
+	if err != nil {
+		return err
+	}
+	return command.Run(repository.Open("."), options)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/repository"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+const DEFAULT_BATCH_FORMAT = "%(objectname) %(objecttype) %(objectsize)"
+
+var batchAtom = regexp.MustCompile(`%\([a-z:]+\)|%%`)
+
+// BatchOptions configures cat-file's --batch, --batch-check and
+// --batch-command modes.
+type BatchOptions struct {
+	// Mode is "--batch", "--batch-check" or "--batch-command".
+	Mode       string
+	Format     string
+	AllObjects bool
+	Buffer     bool
+}
+
+type batchObject struct {
+	name       string
+	objectType string
+	size       int
+	diskSize   int64
+	deltaBase  string
+	rest       string
+}
+
+func expandBatchFormat(format string, batchObject batchObject) (string, error) {
+	var err error
+	expanded := batchAtom.ReplaceAllStringFunc(format, func(atom string) string {
+		switch atom {
+		case "%%":
+			return "%"
+		case "%(objectname)":
+			return batchObject.name
+		case "%(objecttype)":
+			return batchObject.objectType
+		case "%(objectsize)":
+			return fmt.Sprint(batchObject.size)
+		case "%(objectsize:disk)":
+			return fmt.Sprint(batchObject.diskSize)
+		case "%(deltabase)":
+			return batchObject.deltaBase
+		case "%(rest)":
+			return batchObject.rest
+		default:
+			err = fmt.Errorf("unknown format element: %s", atom)
+			return ""
+		}
+	})
+	return expanded, err
+}
+
+// CatFileBatch answers one object lookup per input line, or one per object
+// in the repository with AllObjects, without starting a process per object.
+func CatFileBatch(repo *repository.Repository, input io.Reader, output io.Writer, options BatchOptions) error {
+	if options.Format == "" {
+		options.Format = DEFAULT_BATCH_FORMAT
+	}
+	if _, err := expandBatchFormat(options.Format, batchObject{}); err != nil {
+		return err
+	}
+
+	// As in git, input lines are only split into an object name and the
+	// rest when the format asks for the rest.
+	splitLines := strings.Contains(options.Format, "%(rest)")
+	diskInfo := strings.Contains(options.Format, "%(objectsize:disk)") || strings.Contains(options.Format, "%(deltabase)")
+
+	writer := bufio.NewWriter(output)
+	defer writer.Flush()
+
+	printObject := func(revision string, rest string, contents bool) error {
+		objectName, err := repo.ResolveRevision(revision)
+		batchObject := batchObject{name: objectName, rest: rest}
+		var data []byte
+
+		if errors.Is(err, repository.ErrAmbiguousRevision) {
+			fmt.Fprintf(writer, "%s ambiguous\n", revision)
+			err = nil
+		} else if err != nil {
+			err = object.NotFound(revision)
+		} else if contents {
+			data, batchObject.objectType, err = repo.Objects.Read(objectName)
+			batchObject.size = len(data)
+		} else {
+			batchObject.objectType, batchObject.size, err = repo.Objects.Stat(objectName)
+		}
+		if err == nil && objectName != "" && diskInfo {
+			batchObject.diskSize, batchObject.deltaBase, err = storage.DiskInfo(repo.Objects, objectName)
+			if batchObject.deltaBase == "" {
+				batchObject.deltaBase = strings.Repeat("0", 2*object.SHA1_HASH_LENGTH)
+			}
+		}
+
+		if errors.Is(err, object.ErrObjectNotFound) {
+			fmt.Fprintf(writer, "%s missing\n", revision)
+		} else if err != nil {
+			return err
+		} else if objectName != "" {
+			line, _ := expandBatchFormat(options.Format, batchObject)
+			fmt.Fprintln(writer, line)
+			if contents {
+				writer.Write(data)
+				writer.WriteByte('\n')
+			}
+		}
+
+		if !options.Buffer {
+			return writer.Flush()
+		}
+		return nil
+	}
+
+	if options.AllObjects {
+		names := []string{}
+		err := repo.Objects.Iterate(func(objectName string) error {
+			names = append(names, objectName)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Strings(names)
+		for _, objectName := range names {
+			if err := printObject(objectName, "", options.Mode == "--batch"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		contents := options.Mode == "--batch"
+		if options.Mode == "--batch-command" {
+			command, arguments, _ := strings.Cut(line, " ")
+			switch command {
+			case "contents":
+				contents = true
+			case "info":
+				contents = false
+			case "flush":
+				if !options.Buffer {
+					return errors.New("flush is only for --buffer mode")
+				}
+				if err := writer.Flush(); err != nil {
+					return err
+				}
+				continue
+			default:
+				return fmt.Errorf("unknown command: '%s'", line)
+			}
+			line = arguments
+		}
+
+		objectName, rest := line, ""
+		if splitLines {
+			objectName, rest, _ = strings.Cut(strings.TrimLeft(line, " \t"), " ")
+			rest = strings.TrimLeft(rest, " \t")
+		}
+		if err := printObject(objectName, rest, contents); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func runCatFileBatch(repo *repository.Repository, options *Options) error {
+	batchOptions := BatchOptions{
+		AllObjects: options.Bool("--batch-all-objects"),
+		Buffer:     options.Bool("--buffer"),
+	}
+	for _, mode := range []string{"--batch", "--batch-check", "--batch-command"} {
+		if options.Bool(mode) {
+			if batchOptions.Mode != "" {
+				return findCommand("cat-file").usageError("only one batch option may be specified")
+			}
+			batchOptions.Mode = mode
+			batchOptions.Format = options.String(mode)
+		}
+	}
+	if batchOptions.Mode == "" {
+		return findCommand("cat-file").usageError("--batch-all-objects and --buffer need a batch mode")
+	}
+	if len(options.Args) > 0 {
+		return findCommand("cat-file").usageError("batch modes take no arguments")
+	}
+	return CatFileBatch(repo, os.Stdin, os.Stdout, batchOptions)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/repository"
+)
+
+// CatFile prints information about one object. mode is one of the flags
+// "-t", "-s", "-e" or "-p", or an object type the object must have.
+func CatFile(repo *repository.Repository, mode string, revision string) error {
+	sha1Hash, err := repo.ResolveRevision(revision)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case "-e":
+		if !repo.Objects.Has(sha1Hash) {
+			return &ExitError{Code: EXIT_NEGATIVE}
+		}
+		return nil
+
+	case "-t", "-s":
+		objectType, size, err := repo.Objects.Stat(sha1Hash)
+		if err != nil {
+			return err
+		}
+		if mode == "-t" {
+			fmt.Println(objectType)
+		} else {
+			fmt.Println(size)
+		}
+		return nil
+
+	case "-p":
+		data, objectType, err := repo.Objects.Read(sha1Hash)
+		if err != nil {
+			return err
+		}
+		if objectType != "tree" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		treeEntries, err := object.ParseTree(data)
+		if err != nil {
+			return err
+		}
+		for _, entry := range treeEntries {
+			fmt.Println(formatTreeEntry(entry))
+		}
+		return nil
+
+	default:
+		if object.ParseType(mode) == object.INVALID {
+			return fmt.Errorf("invalid object type \"%s\"", mode)
+		}
+		data, objectType, err := repo.Objects.Read(sha1Hash)
+		if err != nil {
+			return err
+		}
+		if err := object.CheckType(sha1Hash, mode, objectType); err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+}
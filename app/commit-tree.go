@@ -2,31 +2,37 @@ package main
 
 import (
 	"fmt"
-	"time"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
 )
 
-func CommitTree(treeSha1Hash string, message string, username string, email string, parent *string) {
-	commitObject := generateCommitObject(treeSha1Hash, message, username, email, parent)
-	rawSha, _ := computeHashAndStoreObject(GIT_DIR, commitObject)
+func CommitTree(repo *repository.Repository, tree string, message string, username string, email string, parents []string) error {
+	treeSha1Hash, err := resolveAs(repo, tree, "tree")
+	if err != nil {
+		return err
+	}
+	parentHashes := []string{}
+	for _, parent := range parents {
+		parentHash, err := resolveAs(repo, parent, "commit")
+		if err != nil {
+			return err
+		}
+		parentHashes = append(parentHashes, parentHash)
+	}
+
+	rawSha, err := repo.CommitTree(treeSha1Hash, parentHashes, message, username, email)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("%x", rawSha)
+	return nil
 }
 
-func generateCommitObject(treeSha1Hash string, message string, username string, email string, parent *string) []byte {
-	timestampNow := time.Now().Unix()
-	_, timeZoneOffset := time.Now().Zone()
-	timeZoneOffsetStr := fmt.Sprintf("%+03d%02d", timeZoneOffset/3600, (timeZoneOffset%3600)/60)
-
-	commitContent := []byte("tree " + treeSha1Hash + "\n")
-
-	if parent != nil {
-		commitContent = append(commitContent, []byte(fmt.Sprintf("parent %s\n", *parent))...)
+// resolveAs resolves revision and peels it to an object of objectType.
+func resolveAs(repo *repository.Repository, revision string, objectType string) (string, error) {
+	objectName, err := repo.ResolveRevision(revision)
+	if err != nil {
+		return "", err
 	}
-
-	commitContent = append(commitContent, []byte(fmt.Sprintf("author %s <%s> %d %s\n", username, email, timestampNow, timeZoneOffsetStr))...)
-	commitContent = append(commitContent, []byte(fmt.Sprintf("committer %s <%s> %d %s\n\n", username, email, timestampNow, timeZoneOffsetStr))...)
-	commitContent = append(commitContent, []byte(fmt.Sprintf("%s\n", message))...)
-
-	commitObject := []byte(fmt.Sprintf("commit %d\x00", len(commitContent)))
-	commitObject = append(commitObject, commitContent...)
-	return commitObject
+	return repo.Peel(objectName, objectType)
 }
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/codecrafters-io/git-starter-go/server"
+)
+
+// Daemon serves repositories over the git:// protocol on port until
+// accepting connections fails.
+func Daemon(daemon *server.Daemon, port string) error {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Serving on git://localhost:%d/\n", listener.Addr().(*net.TCPAddr).Port)
+	return daemon.Serve(listener)
+}
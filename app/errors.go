@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	EXIT_NEGATIVE = 1
+	EXIT_FATAL    = 128
+	EXIT_USAGE    = 129
+)
+
+// ExitError ends the program with Code and no message. Commands use it when
+// the answer is "no" rather than a failure, like `cat-file -e` on a missing
+// object.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// UsageError is reported as "error: <Message>" followed by the command's
+// usage, with exit status 129.
+type UsageError struct {
+	Message string
+	Usage   string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+// reportError prints err the way git does and returns the exit status for it.
+func reportError(err error) int {
+	var exitError *ExitError
+	var usageError *UsageError
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitError):
+		return exitError.Code
+	case errors.As(err, &usageError):
+		fmt.Fprintf(os.Stderr, "error: %s\n%s", usageError.Message, usageError.Usage)
+		return EXIT_USAGE
+	default:
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		return EXIT_FATAL
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
+)
+
+// dateLayouts are the --shallow-since formats accepted besides a unix
+// timestamp.
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+func parseDate(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(strings.TrimPrefix(value, "@"), 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	for _, layout := range dateLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s'", value)
+}
+
+// shallowOptions reads --depth, --shallow-since and --shallow-exclude.
+func shallowOptions(options *Options) (repository.ShallowOptions, error) {
+	shallow := repository.ShallowOptions{Exclude: options.Strings("--shallow-exclude")}
+	if depth := options.String("--depth"); depth != "" {
+		n, err := strconv.Atoi(depth)
+		if err != nil || n <= 0 {
+			return shallow, fmt.Errorf("depth %s is not a positive number", depth)
+		}
+		shallow.Depth = n
+	}
+	if since := options.String("--shallow-since"); since != "" {
+		date, err := parseDate(since)
+		if err != nil {
+			return shallow, err
+		}
+		shallow.Since = date
+	}
+	return shallow, nil
+}
+
+// ABBREV_LENGTH is the length object names are shortened to in the ref
+// update summary.
+const ABBREV_LENGTH = 7
+
+// shortRefName strips the prefix git leaves out when showing a ref.
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if short, ok := strings.CutPrefix(name, prefix); ok {
+			return short
+		}
+	}
+	return name
+}
+
+// refSummary returns the flag and summary git shows for an update of ref,
+// such as "+" and "1a2b3c4...5d6e7f8" for a forced update.
+func refSummary(status repository.RefStatus, ref, old, new string) (string, string) {
+	kind := "branch"
+	if strings.HasPrefix(ref, "refs/tags/") {
+		kind = "tag"
+	}
+	switch status {
+	case repository.REF_CREATED:
+		return "*", fmt.Sprintf("[new %s]", kind)
+	case repository.REF_FAST_FORWARD:
+		return " ", old[:ABBREV_LENGTH] + ".." + new[:ABBREV_LENGTH]
+	case repository.REF_FORCED:
+		return "+", old[:ABBREV_LENGTH] + "..." + new[:ABBREV_LENGTH]
+	case repository.REF_DELETED:
+		return "-", "[deleted]"
+	case repository.REF_REJECTED:
+		return "!", "[rejected]"
+	case repository.REF_REMOTE_REJECTED:
+		return "!", "[remote rejected]"
+	}
+	return "=", "[up to date]"
+}
+
+// printRefUpdates shows the refs a fetch from url changed, the way git
+// does.
+func printRefUpdates(output io.Writer, url string, updates []repository.RefUpdate) {
+	changed := []repository.RefUpdate{}
+	width := 0
+	for _, update := range updates {
+		if update.Status == repository.REF_UP_TO_DATE {
+			continue
+		}
+		changed = append(changed, update)
+		width = max(width, len(shortRefName(update.RemoteName)))
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	fmt.Fprintf(output, "From %s\n", url)
+	for _, update := range changed {
+		flag, summary := refSummary(update.Status, update.LocalName, update.Old, update.New)
+		note := ""
+		switch {
+		case update.Status == repository.REF_FORCED:
+			note = "(forced update)"
+		case update.Status == repository.REF_REJECTED && strings.HasPrefix(update.LocalName, "refs/tags/"):
+			note = "(would clobber existing tag)"
+		case update.Status == repository.REF_REJECTED:
+			note = "(non-fast-forward)"
+		}
+		remoteName := shortRefName(update.RemoteName)
+		if update.Status == repository.REF_DELETED {
+			remoteName = "(none)"
+		}
+		line := fmt.Sprintf(" %s %-*s %-*s -> %s", flag, 2*ABBREV_LENGTH+3, summary, width, remoteName, shortRefName(update.LocalName))
+		if note != "" {
+			line += "  " + note
+		}
+		fmt.Fprintln(output, line)
+	}
+}
+
+func Fetch(repo *repository.Repository, remoteName string, options repository.FetchOptions) error {
+	updates, err := repo.Fetch(remoteName, options)
+	if options.Progress != nil && updates != nil {
+		config, configErr := repo.Config()
+		if configErr != nil {
+			return configErr
+		}
+		url, _ := config.Get("remote", remoteName, "url")
+		printRefUpdates(options.Progress, url, updates)
+	}
+	// Like a rejected push, rejected ref updates are a "no" rather than a
+	// fatal error.
+	if errors.Is(err, repository.ErrRefsRejected) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return &ExitError{Code: EXIT_NEGATIVE}
+	}
+	return err
+}
@@ -3,33 +3,41 @@ package main
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/repository"
 )
 
-func HashObject(basePath string, filename string, print bool) []byte {
-	file, err := os.Open(filename)
-	if err != nil {
-		log.Fatal("not able to read file %s: %v", filename, err)
+func HashObject(repo *repository.Repository, filenames []string, objectType string, write bool, stdin bool) error {
+	if object.ParseType(objectType) == object.INVALID {
+		return fmt.Errorf("invalid object type \"%s\"", objectType)
 	}
-	defer file.Close()
 
-	contents, err := io.ReadAll(file)
-	if err != nil {
-		log.Fatal("not able to read file %s: %v", filename, err)
+	hashReader := func(reader io.Reader) error {
+		shaCodeRaw, err := repo.HashObject(reader, objectType, write)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%x\n", shaCodeRaw)
+		return nil
 	}
 
-	blob := fmt.Sprintf("%s %d%c%s", "blob", len(contents), 0, contents)
-
-	shaCodeRaw, _ := computeHashAndStoreObject(basePath, []byte(blob))
-
-	if err != nil {
-		log.Fatal("Error generating hash-object")
+	if stdin {
+		if err := hashReader(os.Stdin); err != nil {
+			return err
+		}
 	}
-	if print {
-		fmt.Printf("%x\n", shaCodeRaw)
+	for _, filename := range filenames {
+		file, err := os.Open(filename)
+		if err != nil {
+			return fmt.Errorf("could not open '%s' for reading: %v", filename, err)
+		}
+		err = hashReader(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
 	}
-
-	return shaCodeRaw
-
+	return nil
 }
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/git-starter-go/packfile"
+)
+
+func IndexPack(packPath string) error {
+	checksum, err := packfile.IndexPack(packPath, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%x\n", checksum)
+	return nil
+}
@@ -2,77 +2,389 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
+	"github.com/codecrafters-io/git-starter-go/server"
+	"github.com/codecrafters-io/git-starter-go/transport"
 )
 
 const (
-	SHA1_HASH_LENGTH = 20
-	GIT_DIR          = ".git"
-	META_DATA_END    = 12
-	CHECK_SUM_LENGTH = 20
+	USERNAME = "Krishna Agrawal"
+	EMAIL    = "imkrishnaagrawal@gmail.com"
 )
 
+var commands []*Command
+
+func init() {
+	commands = []*Command{
+		{
+			Name:  "init",
+			Usage: []string{"init [-b <branch-name> | --initial-branch=<branch-name>] [<directory>]"},
+			Flags: []Flag{
+				{Names: []string{"-b", "--initial-branch"}, Value: "name", Help: "override the name of the initial branch"},
+			},
+			MaxArgs: 1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				workDir := "."
+				if len(options.Args) > 0 {
+					workDir = options.Args[0]
+				}
+				return Init(workDir, options.String("-b"))
+			},
+		},
+		{
+			Name: "cat-file",
+			Usage: []string{
+				"cat-file <type> <object>",
+				"cat-file (-e | -p) <object>",
+				"cat-file (-t | -s) <object>",
+				"cat-file (--batch | --batch-check | --batch-command) [--batch-all-objects] [--buffer]",
+			},
+			Flags: []Flag{
+				{Names: []string{"-t"}, Help: "show object type"},
+				{Names: []string{"-s"}, Help: "show object size"},
+				{Names: []string{"-e"}, Help: "exit with zero when there's no error"},
+				{Names: []string{"-p"}, Help: "pretty-print object's content"},
+				{Names: []string{"--batch"}, Value: "format", OptionalValue: true, Help: "show info and content of objects fed from the standard input"},
+				{Names: []string{"--batch-check"}, Value: "format", OptionalValue: true, Help: "show info about objects fed from the standard input"},
+				{Names: []string{"--batch-command"}, Value: "format", OptionalValue: true, Help: "read commands from stdin"},
+				{Names: []string{"--batch-all-objects"}, Help: "with --batch[-check]: process all objects"},
+				{Names: []string{"--buffer"}, Help: "buffer --batch output"},
+			},
+			MaxArgs: 2,
+			Run: func(repo *repository.Repository, options *Options) error {
+				for _, flag := range []string{"--batch", "--batch-check", "--batch-command", "--batch-all-objects", "--buffer"} {
+					if options.Bool(flag) {
+						return runCatFileBatch(repo, options)
+					}
+				}
+
+				modes := []string{}
+				for _, flag := range []string{"-t", "-s", "-e", "-p"} {
+					if options.Bool(flag) {
+						modes = append(modes, flag)
+					}
+				}
+				if len(options.Args) == 2 {
+					modes = append(modes, options.Args[0])
+				}
+				if len(modes) != 1 || len(options.Args) == 0 {
+					return findCommand("cat-file").usageError("exactly one of <type>, -t, -s, -e or -p is required")
+				}
+				return CatFile(repo, modes[0], options.Args[len(options.Args)-1])
+			},
+		},
+		{
+			Name:  "hash-object",
+			Usage: []string{"hash-object [-t <type>] [-w] [--stdin] [--] <file>..."},
+			Flags: []Flag{
+				{Names: []string{"-t"}, Value: "type", Help: "object type"},
+				{Names: []string{"-w"}, Help: "write the object into the object database"},
+				{Names: []string{"--stdin"}, Help: "read the object from stdin"},
+			},
+			MaxArgs: -1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				objectType := options.String("-t")
+				if objectType == "" {
+					objectType = "blob"
+				}
+				return HashObject(repo, options.Args, objectType, options.Bool("-w"), options.Bool("--stdin"))
+			},
+		},
+		{
+			Name:    "ls-tree",
+			Usage:   []string{"ls-tree [--name-only] <tree-ish>"},
+			Flags:   []Flag{{Names: []string{"--name-only"}, Help: "list only filenames"}},
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				return LsTree(repo, options.Args[0], options.Bool("--name-only"))
+			},
+		},
+		{
+			Name:  "write-tree",
+			Usage: []string{"write-tree"},
+			Run: func(repo *repository.Repository, options *Options) error {
+				return WriteTree(repo)
+			},
+		},
+		{
+			Name:  "commit-tree",
+			Usage: []string{"commit-tree <tree> [(-p <parent>)...] [(-m <message>)...]"},
+			Flags: []Flag{
+				{Names: []string{"-p"}, Value: "parent", Help: "id of a parent commit object"},
+				{Names: []string{"-m"}, Value: "message", Help: "commit message"},
+			},
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				message := strings.Join(options.Strings("-m"), "\n\n")
+				return CommitTree(repo, options.Args[0], message, USERNAME, EMAIL, options.Strings("-p"))
+			},
+		},
+		{
+			Name:  "rev-parse",
+			Usage: []string{"rev-parse [--verify] [-q | --quiet] [--] <rev>..."},
+			Flags: []Flag{
+				{Names: []string{"--verify"}, Help: "verify that exactly one object name is given and it exists"},
+				{Names: []string{"-q", "--quiet"}, Help: "with --verify, exit 1 without a message on failure"},
+			},
+			MaxArgs: -1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				return RevParse(repo, options.Args, options.Bool("--verify"), options.Bool("-q"))
+			},
+		},
+		{
+			Name:    "index-pack",
+			Usage:   []string{"index-pack <pack-file>"},
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				return IndexPack(options.Args[0])
+			},
+		},
+		{
+			Name:  "pack-objects",
+			Usage: []string{"pack-objects [-q | --quiet] [--window=<n>] [--depth=<n>] [--delta-base-offset] (--stdout | <base-name>)"},
+			Flags: []Flag{
+				{Names: []string{"-q", "--quiet"}, Help: "do not show progress meter"},
+				{Names: []string{"--stdout"}, Help: "output pack to stdout"},
+				{Names: []string{"--window"}, Value: "n", Help: "limit pack window by objects"},
+				{Names: []string{"--depth"}, Value: "n", Help: "maximum length of delta chain allowed in the resulting pack"},
+				{Names: []string{"--delta-base-offset"}, Help: "use OFS_DELTA objects"},
+			},
+			MaxArgs: 1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				if options.Bool("--stdout") == (len(options.Args) == 1) {
+					return findCommand("pack-objects").usageError("exactly one of --stdout and <base-name> is required")
+				}
+				packOptions, err := packOptions(options)
+				if err != nil {
+					return err
+				}
+				baseName := ""
+				if len(options.Args) > 0 {
+					baseName = options.Args[0]
+				}
+				var progress io.Writer = os.Stderr
+				if options.Bool("-q") {
+					progress = nil
+				}
+				return PackObjects(repo, baseName, options.Bool("--stdout"), packOptions, progress)
+			},
+		},
+		{
+			Name:  "clone",
+			Usage: []string{"clone [-q | --quiet] [-b <name> | --branch <name>] [--depth <depth>] [--shallow-since <date>] [--shallow-exclude <ref>] [--filter=<filter-spec>] [-l | --local | --no-local] [--] <repo> [<dir>]"},
+			Flags: []Flag{
+				{Names: []string{"-q", "--quiet"}, Help: "be quiet"},
+				{Names: []string{"-b", "--branch"}, Value: "branch", Help: "checkout <branch> instead of the remote's HEAD"},
+				{Names: []string{"--depth"}, Value: "depth", Help: "create a shallow clone of that depth"},
+				{Names: []string{"--shallow-since"}, Value: "time", Help: "create a shallow clone since a specific time"},
+				{Names: []string{"--shallow-exclude"}, Value: "ref", Help: "deepen history of shallow clone, excluding ref"},
+				{Names: []string{"--filter"}, Value: "args", Help: "object filtering"},
+				{Names: []string{"-l", "--local"}, Help: "to clone from a local repository"},
+				{Names: []string{"--no-local"}, Help: "fetch from a local repository like any other remote"},
+			},
+			MinArgs: 1,
+			MaxArgs: 2,
+			Run: func(repo *repository.Repository, options *Options) error {
+				cloneUrl := options.Args[0]
+				dir := strings.TrimSuffix(filepath.Base(strings.TrimSuffix(strings.TrimRight(cloneUrl, "/"), "/.git")), ".git")
+				if len(options.Args) > 1 {
+					dir = options.Args[1]
+				}
+				shallow, err := shallowOptions(options)
+				if err != nil {
+					return err
+				}
+				cloneOptions := repository.CloneOptions{
+					Branch:         options.String("-b"),
+					ShallowOptions: shallow,
+					Filter:         options.String("--filter"),
+					Progress:       os.Stderr,
+					Warnings:       os.Stderr,
+				}
+				if options.Bool("-q") {
+					cloneOptions.Progress = nil
+					cloneOptions.Warnings = nil
+				}
+				// Plain paths are cloned locally unless --no-local is
+				// given; file:// URLs only with --local.
+				if path, ok := transport.LocalPath(cloneUrl); ok {
+					cloneOptions.Local = options.Bool("-l") || path == cloneUrl && !options.Bool("--no-local")
+				}
+				return Clone(cloneUrl, dir, cloneOptions)
+			},
+		},
+		{
+			Name:  "fetch",
+			Usage: []string{"fetch [-q | --quiet] [-f | --force] [-p | --prune] [--depth <depth>] [--shallow-since <date>] [--shallow-exclude <ref>] [--unshallow] [<repository>]"},
+			Flags: []Flag{
+				{Names: []string{"-q", "--quiet"}, Help: "be quiet"},
+				{Names: []string{"-f", "--force"}, Help: "force overwrite of local reference"},
+				{Names: []string{"-p", "--prune"}, Help: "prune remote-tracking branches no longer on remote"},
+				{Names: []string{"--depth"}, Value: "depth", Help: "deepen history of shallow clone"},
+				{Names: []string{"--shallow-since"}, Value: "time", Help: "deepen history of shallow repository based on time"},
+				{Names: []string{"--shallow-exclude"}, Value: "ref", Help: "deepen history of shallow clone, excluding ref"},
+				{Names: []string{"--unshallow"}, Help: "convert to a complete repository"},
+			},
+			MaxArgs: 1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				remoteName := repository.DEFAULT_REMOTE
+				if len(options.Args) > 0 {
+					remoteName = options.Args[0]
+				}
+				shallow, err := shallowOptions(options)
+				if err != nil {
+					return err
+				}
+				if options.Bool("--unshallow") && shallow.Depth > 0 {
+					return findCommand("fetch").usageError("--depth and --unshallow cannot be used together")
+				}
+				fetchOptions := repository.FetchOptions{
+					ShallowOptions: shallow,
+					Unshallow:      options.Bool("--unshallow"),
+					Force:          options.Bool("-f"),
+					Prune:          options.Bool("-p"),
+					Progress:       os.Stderr,
+				}
+				if options.Bool("-q") {
+					fetchOptions.Progress = nil
+				}
+				return Fetch(repo, remoteName, fetchOptions)
+			},
+		},
+		{
+			Name:  "push",
+			Usage: []string{"push [-q | --quiet] [-f | --force] [--force-with-lease[=<refname>[:<expect>]]] [--atomic] [-d | --delete] [<repository> [<refspec>...]]"},
+			Flags: []Flag{
+				{Names: []string{"-q", "--quiet"}, Help: "be quiet"},
+				{Names: []string{"-f", "--force"}, Help: "force updates"},
+				{Names: []string{"--force-with-lease"}, Value: "refname>:<expect", OptionalValue: true, Help: "require old value of ref to be at this value"},
+				{Names: []string{"--atomic"}, Help: "request atomic transaction on remote side"},
+				{Names: []string{"-d", "--delete"}, Help: "delete refs"},
+			},
+			MaxArgs: -1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				remoteName := repository.DEFAULT_REMOTE
+				refspecs := []string{}
+				if len(options.Args) > 0 {
+					remoteName, refspecs = options.Args[0], options.Args[1:]
+				}
+				if options.Bool("-d") {
+					if len(refspecs) == 0 {
+						return findCommand("push").usageError("--delete doesn't make sense without any refs")
+					}
+					for i, refspec := range refspecs {
+						refspecs[i] = ":" + refspec
+					}
+				}
+				pushOptions := repository.PushOptions{
+					Force:    options.Bool("-f"),
+					Atomic:   options.Bool("--atomic"),
+					Progress: os.Stderr,
+				}
+				for _, lease := range options.Strings("--force-with-lease") {
+					pushOptions.ForceWithLease = append(pushOptions.ForceWithLease, parseLease(lease))
+				}
+				if options.Bool("-q") {
+					pushOptions.Progress = nil
+				}
+				return Push(repo, remoteName, refspecs, pushOptions, options.Bool("-q"))
+			},
+		},
+		{
+			Name:  "upload-pack",
+			Usage: []string{"upload-pack [--stateless-rpc] [--advertise-refs] <directory>"},
+			Flags: []Flag{
+				{Names: []string{"--stateless-rpc"}, Help: "quit after a single request/response exchange"},
+				{Names: []string{"--advertise-refs"}, Help: "exit immediately after initial ref advertisement"},
+			},
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				return ServePack("upload-pack", options.Args[0], server.Options{
+					AdvertiseRefs: options.Bool("--advertise-refs"),
+					StatelessRPC:  options.Bool("--stateless-rpc"),
+				})
+			},
+		},
+		{
+			Name:  "receive-pack",
+			Usage: []string{"receive-pack [--stateless-rpc] [--advertise-refs] <directory>"},
+			Flags: []Flag{
+				{Names: []string{"--stateless-rpc"}, Help: "quit after a single request/response exchange"},
+				{Names: []string{"--advertise-refs"}, Help: "exit immediately after initial ref advertisement"},
+			},
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				return ServePack("receive-pack", options.Args[0], server.Options{
+					AdvertiseRefs: options.Bool("--advertise-refs"),
+					StatelessRPC:  options.Bool("--stateless-rpc"),
+				})
+			},
+		},
+		{
+			Name:  "daemon",
+			Usage: []string{"daemon [--port=<n>] [--base-path=<path>] [--export-all] [--enable=receive-pack] [<directory>...]"},
+			Flags: []Flag{
+				{Names: []string{"--port"}, Value: "n", Help: "listen on port <n>, " + transport.DEFAULT_DAEMON_PORT + " by default"},
+				{Names: []string{"--base-path"}, Value: "path", Help: "serve the requested paths relative to <path>"},
+				{Names: []string{"--export-all"}, Help: "serve repositories without git-daemon-export-ok"},
+				{Names: []string{"--enable"}, Value: "service", Help: "enable a service, receive-pack, for every repository"},
+			},
+			MaxArgs: -1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				daemon := server.NewDaemon(options.String("--base-path"))
+				daemon.Directories = options.Args
+				daemon.ExportAll = options.Bool("--export-all")
+				for _, service := range options.Strings("--enable") {
+					if service != "receive-pack" && service != "upload-pack" {
+						return findCommand("daemon").usageError("unknown service '%s'", service)
+					}
+					daemon.ReceivePack = daemon.ReceivePack || service == "receive-pack"
+				}
+				port := options.String("--port")
+				if port == "" {
+					port = transport.DEFAULT_DAEMON_PORT
+				}
+				return Daemon(daemon, port)
+			},
+		},
+		{
+			Name:  "serve",
+			Usage: []string{"serve [--port <port>] [--enable-receive-pack] [<directory>]"},
+			Flags: []Flag{
+				{Names: []string{"--port"}, Value: "port", Help: "listen on <port>, " + DEFAULT_HTTP_PORT + " by default"},
+				{Names: []string{"--enable-receive-pack"}, Help: "allow pushing to repositories that do not set http.receivepack"},
+			},
+			MaxArgs: 1,
+			Run: func(repo *repository.Repository, options *Options) error {
+				root := "."
+				if len(options.Args) > 0 {
+					root = options.Args[0]
+				}
+				port := options.String("--port")
+				if port == "" {
+					port = DEFAULT_HTTP_PORT
+				}
+				return Serve(root, port, options.Bool("--enable-receive-pack"))
+			},
+		},
+	}
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Fprintf(os.Stderr, "usage: ./your_program.sh <command> [<args>...]\n")
 		os.Exit(1)
 	}
 
-	switch command := os.Args[1]; command {
-	case "init":
-		Init(GIT_DIR)
-
-	case "cat-file":
-		if len(os.Args) < 4 {
-			log.Fatal("Missing arguments for cat-file")
-		}
-		sha1Hash := os.Args[3]
-		CatFile(sha1Hash)
-
-	case "hash-object":
-		if len(os.Args) < 4 {
-			log.Fatal("Missing file argument for hash-object")
-		}
-		HashObject(GIT_DIR, os.Args[3], true)
-
-	case "ls-tree":
-		sha1Hash := os.Args[2]
-		nameOnly := false
-		if os.Args[2] == "--name-only" {
-			sha1Hash = os.Args[3]
-			nameOnly = true
-		}
-		LsTree(sha1Hash, nameOnly)
-
-	case "write-tree":
-		WriteTree()
-
-	case "commit-tree":
-		var message string
-		var parent string
-		var username string = "Krishna Agrawal"
-		var email string = "imkrishnaagrawal@gmail.com"
-
-		if os.Args[3] == "-m" {
-			message = os.Args[4]
-		} else {
-			message = os.Args[6]
-		}
-
-		if os.Args[3] == "-p" {
-			parent = os.Args[4]
-		}
-
-		CommitTree(os.Args[2], message, username, email, &parent)
-
-	case "clone":
-		cloneUrl := os.Args[2]
-		dir := os.Args[3]
-		Clone(cloneUrl, dir)
-
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command %s\n", command)
-		os.Exit(1)
-	}
+	os.Exit(reportError(run(os.Args[1], os.Args[2:])))
 }
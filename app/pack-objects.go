@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/packfile"
+	"github.com/codecrafters-io/git-starter-go/repository"
+)
+
+// readPackObjects reads "<object> [<path>]" lines, as printed by
+// `rev-list --objects`.
+func readPackObjects(reader io.Reader) ([]packfile.PackObject, error) {
+	objects := []packfile.PackObject{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		objectName, path, _ := strings.Cut(line, " ")
+		if !object.IsName(objectName) {
+			return nil, fmt.Errorf("expected object ID, got garbage:\n %s", line)
+		}
+		objects = append(objects, packfile.PackObject{Name: objectName, Path: path})
+	}
+	return objects, scanner.Err()
+}
+
+// packOptions reads --window, --depth and --delta-base-offset.
+func packOptions(options *Options) (packfile.PackOptions, error) {
+	packOptions := packfile.DefaultPackOptions()
+	packOptions.OffsetDeltas = options.Bool("--delta-base-offset")
+	for flag, value := range map[string]*int{"--window": &packOptions.Window, "--depth": &packOptions.Depth} {
+		if option := options.String(flag); option != "" {
+			n, err := strconv.Atoi(option)
+			if err != nil || n < 0 {
+				return packOptions, findCommand("pack-objects").usageError("option `%s' expects a non-negative number", strings.TrimPrefix(flag, "--"))
+			}
+			*value = n
+		}
+	}
+	return packOptions, nil
+}
+
+// PackObjects packs the objects named on stdin, either to stdout or as
+// <baseName>-<checksum>.pack and .idx, printing the checksum.
+func PackObjects(repo *repository.Repository, baseName string, toStdout bool, packOptions packfile.PackOptions, progressOutput io.Writer) error {
+	objects, err := readPackObjects(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	if toStdout {
+		output := bufio.NewWriter(os.Stdout)
+		if _, err := packfile.WriteObjects(output, objects, repo.Objects, packOptions, progressOutput); err != nil {
+			return err
+		}
+		return output.Flush()
+	}
+	checksum, err := packfile.WritePackFile(baseName, objects, repo.Objects, packOptions, progressOutput)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%x\n", checksum)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
+)
+
+// parseLease reads the value of --force-with-lease: empty, <ref> or
+// <ref>:<expect>.
+func parseLease(value string) repository.Lease {
+	ref, expect, _ := strings.Cut(value, ":")
+	return repository.Lease{Ref: ref, Expect: expect}
+}
+
+// printPushUpdates shows the outcome of a push to url the way git does.
+func printPushUpdates(output io.Writer, url string, updates []repository.PushUpdate) {
+	changed := []repository.PushUpdate{}
+	for _, update := range updates {
+		if update.Status != repository.REF_UP_TO_DATE {
+			changed = append(changed, update)
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Fprintln(output, "Everything up-to-date")
+		return
+	}
+
+	fmt.Fprintf(output, "To %s\n", url)
+	for _, update := range changed {
+		flag, summary := refSummary(update.Status, update.Destination, update.Old, update.New)
+		line := fmt.Sprintf(" %s %-*s ", flag, 2*ABBREV_LENGTH+3, summary)
+		if update.Source == "" {
+			line += shortRefName(update.Destination)
+		} else {
+			line += shortRefName(update.Source) + " -> " + shortRefName(update.Destination)
+		}
+		switch {
+		case update.Reason != "":
+			line += fmt.Sprintf(" (%s)", update.Reason)
+		case update.Status == repository.REF_FORCED:
+			line += " (forced update)"
+		}
+		fmt.Fprintln(output, line)
+	}
+}
+
+// Push pushes refspecs to remoteName and lists the updated refs on stderr
+// unless quiet is set.
+func Push(repo *repository.Repository, remoteName string, refspecs []string, options repository.PushOptions, quiet bool) error {
+	updates, err := repo.Push(remoteName, refspecs, options)
+	url := remoteName
+	if config, configErr := repo.Config(); configErr == nil {
+		if remoteURL, ok := config.Get("remote", remoteName, "url"); ok {
+			url = remoteURL
+		}
+	}
+	if !quiet && updates != nil {
+		printPushUpdates(os.Stderr, url, updates)
+	}
+	if errors.Is(err, repository.ErrPushRejected) {
+		fmt.Fprintf(os.Stderr, "error: failed to push some refs to '%s'\n", url)
+		return &ExitError{Code: EXIT_NEGATIVE}
+	}
+	return err
+}
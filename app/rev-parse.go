@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
+)
+
+// RevParse prints the object name of each revision. With verify exactly one
+// revision is expected, and quiet turns a failure into a silent exit 1.
+func RevParse(repo *repository.Repository, revisions []string, verify bool, quiet bool) error {
+	if verify && len(revisions) != 1 {
+		if quiet {
+			return &ExitError{Code: EXIT_NEGATIVE}
+		}
+		return fmt.Errorf("needed a single revision")
+	}
+
+	for _, revision := range revisions {
+		objectName, err := repo.ResolveRevision(revision)
+		if err != nil && quiet {
+			return &ExitError{Code: EXIT_NEGATIVE}
+		}
+		if err != nil {
+			return err
+		}
+		if verify && !repo.Objects.Has(objectName) {
+			return fmt.Errorf("needed a single revision")
+		}
+		fmt.Println(objectName)
+	}
+	return nil
+}
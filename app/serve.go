@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/codecrafters-io/git-starter-go/server"
+)
+
+const DEFAULT_HTTP_PORT = "8080"
+
+// Serve serves the repositories below root over smart HTTP until the
+// server fails.
+func Serve(root string, port string, receivePack bool) error {
+	handler := server.NewHandler(root)
+	handler.ReceivePack = receivePack
+
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Serving %s on http://localhost:%d/\n", root, listener.Addr().(*net.TCPAddr).Port)
+	return http.Serve(listener, handler)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
+	"github.com/codecrafters-io/git-starter-go/server"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// ServePack runs service, upload-pack or receive-pack, for the repository
+// at dir over standard input and output, as ssh runs it for a client. The
+// protocol version comes from GIT_PROTOCOL.
+func ServePack(service string, dir string, options server.Options) error {
+	repo := repository.Find(dir)
+	if repo == nil {
+		return fmt.Errorf("'%s' %w", dir, transport.ErrNotRepository)
+	}
+	options.Version = server.ProtocolVersion(os.Getenv("GIT_PROTOCOL"))
+	if service == "receive-pack" {
+		options.Version = 0
+		return server.ReceivePack(repo, os.Stdin, os.Stdout, options)
+	}
+	return server.UploadPack(repo, os.Stdin, os.Stdout, options)
+}
@@ -0,0 +1,80 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Commit struct {
+	Tree      string
+	Parents   []string
+	Author    string
+	Committer string
+	Message   string
+}
+
+// Signature formats an author or committer line value.
+func Signature(username string, email string, when time.Time) string {
+	_, timeZoneOffset := when.Zone()
+	sign := '+'
+	if timeZoneOffset < 0 {
+		sign = '-'
+		timeZoneOffset = -timeZoneOffset
+	}
+	timeZoneOffsetStr := fmt.Sprintf("%c%02d%02d", sign, timeZoneOffset/3600, (timeZoneOffset%3600)/60)
+	return fmt.Sprintf("%s <%s> %d %s", username, email, when.Unix(), timeZoneOffsetStr)
+}
+
+// SignatureTime returns the timestamp of an author or committer line
+// value, or the zero time when it has none.
+func SignatureTime(signature string) time.Time {
+	fields := strings.Fields(signature[strings.LastIndex(signature, ">")+1:])
+	if len(fields) == 0 {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+func ParseCommit(data []byte) (*Commit, error) {
+	commit := &Commit{}
+	headers, message, _ := bytes.Cut(data, []byte("\n\n"))
+	commit.Message = string(message)
+
+	for _, line := range strings.Split(string(headers), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author":
+			commit.Author = value
+		case "committer":
+			commit.Committer = value
+		}
+	}
+
+	if !IsName(commit.Tree) {
+		return nil, fmt.Errorf("%w: commit has no tree", ErrCorruptObject)
+	}
+	return commit, nil
+}
+
+// Bytes encodes the commit as the payload of a commit object.
+func (commit *Commit) Bytes() []byte {
+	commitContent := []byte("tree " + commit.Tree + "\n")
+	for _, parent := range commit.Parents {
+		commitContent = append(commitContent, []byte(fmt.Sprintf("parent %s\n", parent))...)
+	}
+	commitContent = append(commitContent, []byte(fmt.Sprintf("author %s\n", commit.Author))...)
+	commitContent = append(commitContent, []byte(fmt.Sprintf("committer %s\n\n", commit.Committer))...)
+	commitContent = append(commitContent, []byte(commit.Message)...)
+	return commitContent
+}
@@ -0,0 +1,62 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrObjectNotFound means no store holds the object.
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrInvalidName means a string is not a usable object name.
+	ErrInvalidName = errors.New("not a valid object name")
+	// ErrCorruptObject means an object exists but cannot be decoded.
+	ErrCorruptObject = errors.New("corrupt object")
+)
+
+// ObjectError ties one of the errors above to the object it is about.
+type ObjectError struct {
+	Name string
+	Err  error
+}
+
+func (e *ObjectError) Error() string {
+	return fmt.Sprintf("%v %s", e.Err, e.Name)
+}
+
+func (e *ObjectError) Unwrap() error {
+	return e.Err
+}
+
+func NotFound(objectName string) error {
+	return &ObjectError{Name: objectName, Err: ErrObjectNotFound}
+}
+
+func InvalidName(objectName string) error {
+	return &ObjectError{Name: objectName, Err: ErrInvalidName}
+}
+
+// Corrupt reports why the object objectName could not be decoded.
+func Corrupt(objectName string, reason string) error {
+	return &ObjectError{Name: objectName, Err: fmt.Errorf("%w (%s)", ErrCorruptObject, reason)}
+}
+
+// TypeError is returned when an object exists but has a different type
+// than the caller asked for.
+type TypeError struct {
+	Name     string
+	Expected string
+	Actual   string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("object %s is a %s, not a %s", e.Name, e.Actual, e.Expected)
+}
+
+// CheckType returns a TypeError unless actual is expected.
+func CheckType(objectName string, expected string, actual string) error {
+	if expected != actual {
+		return &TypeError{Name: objectName, Expected: expected, Actual: actual}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package object
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+)
+
+// Hash returns the raw SHA-1 name of an object with the given type and
+// payload.
+func Hash(objectType string, data []byte) []byte {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d", objectType, len(data))
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// IsName reports whether objectName is a full 40 character hex object name.
+func IsName(objectName string) bool {
+	if len(objectName) != 2*SHA1_HASH_LENGTH {
+		return false
+	}
+	_, err := hex.DecodeString(objectName)
+	return err == nil
+}
@@ -0,0 +1,40 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type Tag struct {
+	Object  string
+	Type    string
+	Tag     string
+	Tagger  string
+	Message string
+}
+
+func ParseTag(data []byte) (*Tag, error) {
+	tag := &Tag{}
+	headers, message, _ := bytes.Cut(data, []byte("\n\n"))
+	tag.Message = string(message)
+
+	for _, line := range strings.Split(string(headers), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Tag = value
+		case "tagger":
+			tag.Tagger = value
+		}
+	}
+
+	if !IsName(tag.Object) || ParseType(tag.Type) == INVALID {
+		return nil, fmt.Errorf("%w: tag has no valid object", ErrCorruptObject)
+	}
+	return tag, nil
+}
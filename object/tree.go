@@ -0,0 +1,77 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ParseTree decodes the payload of a tree object. Entry types are derived
+// from their modes, so no other objects need to be read.
+func ParseTree(data []byte) ([]TreeEntry, error) {
+	treeEntries := []TreeEntry{}
+	offset := 0
+	for offset < len(data) {
+		modeEndOffset := bytes.IndexByte(data[offset:], ' ')
+		if modeEndOffset == -1 {
+			return nil, fmt.Errorf("%w: mode not found in tree", ErrCorruptObject)
+		}
+
+		modeStr := string(data[offset : offset+modeEndOffset])
+		mode, err := strconv.Atoi(modeStr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid mode in tree: %v", ErrCorruptObject, err)
+		}
+
+		offset += modeEndOffset + 1
+
+		nameEndOffset := bytes.IndexByte(data[offset:], 0)
+		if nameEndOffset == -1 {
+			return nil, fmt.Errorf("%w: name not found in tree", ErrCorruptObject)
+		}
+
+		fileName := string(data[offset : offset+nameEndOffset])
+		offset += nameEndOffset + 1
+
+		if offset+SHA1_HASH_LENGTH > len(data) {
+			return nil, fmt.Errorf("%w: SHA-1 hash is missing or incomplete in tree", ErrCorruptObject)
+		}
+
+		treeEntries = append(treeEntries, TreeEntry{
+			Mode:   Mode(mode),
+			Object: modeBlobType(Mode(mode)),
+			Hash:   bytes.Clone(data[offset : offset+SHA1_HASH_LENGTH]),
+			Name:   fileName,
+		})
+
+		offset += SHA1_HASH_LENGTH
+	}
+
+	return treeEntries, nil
+}
+
+func modeBlobType(mode Mode) BlobType {
+	switch mode {
+	case DIR:
+		return TREE
+	case GITLINK:
+		return COMMIT
+	default:
+		return BLOB
+	}
+}
+
+// Bytes encodes the tree as the payload of a tree object, sorting its
+// entries by name.
+func (tree Tree) Bytes() []byte {
+	var treeData []byte
+	entries := tree.Entries
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	for _, entry := range entries {
+		treeData = append(treeData, []byte(fmt.Sprintf("%d %s\x00", entry.Mode, entry.Name))...)
+		treeData = append(treeData, entry.Hash...)
+	}
+	return treeData
+}
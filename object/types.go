@@ -0,0 +1,114 @@
+// Package object defines git's object model: object types, tree entries,
+// commits and how objects are named.
+package object
+
+import "fmt"
+
+type Mode int
+type ObjectType int
+type BlobType string
+
+const SHA1_HASH_LENGTH = 20
+
+const (
+	INVALID       ObjectType = 0
+	OBJ_COMMIT    ObjectType = 1
+	OBJ_TREE      ObjectType = 2
+	OBJ_BLOB      ObjectType = 3
+	OBJ_TAG       ObjectType = 4
+	OBJ_OFS_DELTA ObjectType = 6
+	OBJ_REF_DELTA ObjectType = 7
+)
+
+const (
+	DIR             Mode = 40000
+	REGULAR_FILE    Mode = 100644
+	EXECUTABLE_FILE Mode = 100755
+	SYMBOLIC_LINK   Mode = 120000
+	GITLINK         Mode = 160000
+)
+
+const (
+	TREE   BlobType = "tree"
+	BLOB   BlobType = "blob"
+	COMMIT BlobType = "commit"
+)
+
+type TreeEntry struct {
+	Mode   Mode
+	Object BlobType
+	Hash   []byte
+	Name   string
+}
+
+type Tree struct {
+	Entries []TreeEntry
+}
+
+func ObjectTypeName(t ObjectType) string {
+	switch t {
+
+	case OBJ_COMMIT:
+		return "OBJ_COMMIT"
+	case OBJ_TREE:
+		return "OBJ_TREE"
+	case OBJ_BLOB:
+		return "OBJ_BLOB"
+	case OBJ_TAG:
+		return "OBJ_TAG"
+	case OBJ_OFS_DELTA:
+		return "OBJ_OFS_DELTA"
+	case OBJ_REF_DELTA:
+		return "OBJ_REF_DELTA"
+	case INVALID:
+		return "INVALID"
+	default:
+		return "Unknown"
+	}
+}
+
+func StringToBlobType(str string) (BlobType, error) {
+	switch str {
+	case "tree":
+		return TREE, nil
+	case "blob":
+		return BLOB, nil
+	case "commit":
+		return COMMIT, nil
+	default:
+		return "", fmt.Errorf("invalid BlobType: %s", str)
+	}
+}
+
+// TypeString returns the name git uses for t in object headers, or "" for
+// delta and invalid types.
+func TypeString(t ObjectType) string {
+	switch t {
+	case OBJ_COMMIT:
+		return "commit"
+	case OBJ_TREE:
+		return "tree"
+	case OBJ_BLOB:
+		return "blob"
+	case OBJ_TAG:
+		return "tag"
+	default:
+		return ""
+	}
+}
+
+// ParseType is the inverse of TypeString.
+func ParseType(str string) ObjectType {
+	switch str {
+	case "commit":
+		return OBJ_COMMIT
+	case "tree":
+		return OBJ_TREE
+	case "blob":
+		return OBJ_BLOB
+	case "tag":
+		return OBJ_TAG
+	default:
+		return INVALID
+	}
+}
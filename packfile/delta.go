@@ -0,0 +1,169 @@
+package packfile
+
+import (
+	"bytes"
+	"hash/fnv"
+)
+
+const (
+	// DELTA_BLOCK_SIZE is the length of the base blocks that are indexed,
+	// and so the shortest match worth a copy instruction.
+	DELTA_BLOCK_SIZE = 16
+	// MAX_COPY_SIZE is the most one copy instruction copies in a version 2
+	// pack, and MAX_INSERT_SIZE the most one insert instruction carries.
+	MAX_COPY_SIZE   = 0x10000
+	MAX_INSERT_SIZE = 0x7F
+	// MAX_BLOCK_OFFSETS bounds the base offsets kept for one block, so
+	// repetitive data does not make matching quadratic.
+	MAX_BLOCK_OFFSETS = 64
+)
+
+// encodeSize encodes a delta header size, the reverse of readSize.
+func encodeSize(size uint64) []byte {
+	encoded := []byte{}
+	for {
+		b := byte(size & 0x7F)
+		size >>= 7
+		if size == 0 {
+			return append(encoded, b)
+		}
+		encoded = append(encoded, b|0x80)
+	}
+}
+
+// encodeOffset encodes the distance back to an OBJ_OFS_DELTA base, the
+// reverse of readOffset.
+func encodeOffset(offset uint64) []byte {
+	encoded := []byte{byte(offset & 0x7F)}
+	for offset >>= 7; offset > 0; offset >>= 7 {
+		offset--
+		encoded = append([]byte{0x80 | byte(offset&0x7F)}, encoded...)
+	}
+	return encoded
+}
+
+// deltaIndex maps every aligned block of a base object to where it
+// occurs, so that many targets can be matched against the same base.
+type deltaIndex struct {
+	base   []byte
+	blocks map[uint64][]int
+}
+
+func blockHash(block []byte) uint64 {
+	hash := fnv.New64a()
+	hash.Write(block)
+	return hash.Sum64()
+}
+
+func newDeltaIndex(base []byte) *deltaIndex {
+	index := &deltaIndex{base: base, blocks: map[uint64][]int{}}
+	for offset := 0; offset+DELTA_BLOCK_SIZE <= len(base); offset += DELTA_BLOCK_SIZE {
+		hash := blockHash(base[offset : offset+DELTA_BLOCK_SIZE])
+		if len(index.blocks[hash]) < MAX_BLOCK_OFFSETS {
+			index.blocks[hash] = append(index.blocks[hash], offset)
+		}
+	}
+	return index
+}
+
+// deltaEncoder collects copy and insert instructions.
+type deltaEncoder struct {
+	delta   []byte
+	pending []byte
+}
+
+func (e *deltaEncoder) insert(b byte) {
+	e.pending = append(e.pending, b)
+}
+
+func (e *deltaEncoder) flushInsert() {
+	for len(e.pending) > 0 {
+		n := min(len(e.pending), MAX_INSERT_SIZE)
+		e.delta = append(e.delta, byte(n))
+		e.delta = append(e.delta, e.pending[:n]...)
+		e.pending = e.pending[n:]
+	}
+}
+
+// copyFrom encodes copies of base[offset:offset+size], leaving out the zero
+// bytes of the offset and size as ApplyDelta expects.
+func (e *deltaEncoder) copyFrom(offset int, size int) {
+	e.flushInsert()
+	for size > 0 {
+		n := min(size, MAX_COPY_SIZE)
+		opcode := byte(0x80)
+		arguments := []byte{}
+		for i := 0; i < 4; i++ {
+			if b := byte(offset >> (8 * i)); b != 0 {
+				opcode |= 1 << i
+				arguments = append(arguments, b)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if b := byte(n >> (8 * i)); b != 0 {
+				opcode |= 1 << (4 + i)
+				arguments = append(arguments, b)
+			}
+		}
+		e.delta = append(e.delta, opcode)
+		e.delta = append(e.delta, arguments...)
+		offset += n
+		size -= n
+	}
+}
+
+// createDelta encodes target as copies from the indexed base and inserts
+// of new data, in the format ApplyDelta decodes. It returns nil when the
+// delta would be longer than maxSize.
+func (index *deltaIndex) createDelta(target []byte, maxSize int) []byte {
+	base := index.base
+	encoder := &deltaEncoder{}
+	encoder.delta = append(encodeSize(uint64(len(base))), encodeSize(uint64(len(target)))...)
+
+	for position := 0; position < len(target); {
+		if len(encoder.delta)+len(encoder.pending) > maxSize {
+			return nil
+		}
+		bestOffset, bestSize := 0, 0
+		if position+DELTA_BLOCK_SIZE <= len(target) {
+			block := target[position : position+DELTA_BLOCK_SIZE]
+			for _, offset := range index.blocks[blockHash(block)] {
+				if !bytes.Equal(base[offset:offset+DELTA_BLOCK_SIZE], block) {
+					continue
+				}
+				size := DELTA_BLOCK_SIZE
+				for offset+size < len(base) && position+size < len(target) && base[offset+size] == target[position+size] {
+					size++
+				}
+				if size > bestSize {
+					bestOffset, bestSize = offset, size
+				}
+			}
+		}
+		if bestSize < DELTA_BLOCK_SIZE {
+			encoder.insert(target[position])
+			position++
+			continue
+		}
+
+		// Grow the match backwards over data that would otherwise be
+		// inserted.
+		position += bestSize
+		for bestOffset > 0 && len(encoder.pending) > 0 && base[bestOffset-1] == encoder.pending[len(encoder.pending)-1] {
+			bestOffset--
+			bestSize++
+			encoder.pending = encoder.pending[:len(encoder.pending)-1]
+		}
+		encoder.copyFrom(bestOffset, bestSize)
+	}
+	encoder.flushInsert()
+	if len(encoder.delta) > maxSize {
+		return nil
+	}
+	return encoder.delta
+}
+
+// CreateDelta returns a delta that turns base into target.
+func CreateDelta(base, target []byte) []byte {
+	return newDeltaIndex(base).createDelta(target, len(target)+len(target)/MAX_INSERT_SIZE+32)
+}
@@ -0,0 +1,14 @@
+package packfile
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrBadPackfile is wrapped by every error caused by malformed pack or
+// index data, including deltas that cannot be applied.
+var ErrBadPackfile = errors.New("bad packfile")
+
+func badPackfile(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrBadPackfile, fmt.Sprintf(format, args...))
+}
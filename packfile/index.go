@@ -0,0 +1,152 @@
+package packfile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/progress"
+)
+
+type IndexEntry struct {
+	sha1Hash []byte
+	offset   uint64
+	crc      uint32
+}
+
+// IndexPack writes a version 2 .idx next to the .pack at packPath and
+// returns the pack checksum, which also names the pack. Progress meters are
+// drawn on progressOutput unless it is nil.
+func IndexPack(packPath string, progressOutput io.Writer) ([]byte, error) {
+	if !strings.HasSuffix(packPath, ".pack") {
+		return nil, fmt.Errorf("packfile name %s does not end with .pack", packPath)
+	}
+	file, err := os.Open(packPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	receiving := progress.New(progressOutput, "Indexing objects", 0)
+	objects, entries, checksum, err := scanPack(newPackReader(file, nil), receiving)
+	if err != nil {
+		return nil, err
+	}
+	receiving.Done()
+
+	if err := resolveDeltas(&Packfile{file: file}, objects, entries, progressOutput); err != nil {
+		return nil, err
+	}
+	return checksum, writeIndexAtomic(strings.TrimSuffix(packPath, ".pack")+".idx", entries, checksum)
+}
+
+// WritePack stores the pack read from reader as dir/pack-<checksum>.pack
+// and indexes it. The stream is written to a temporary file as it is
+// parsed, so memory use does not grow with the size of the pack. A thin
+// pack is completed with the delta bases it lacks from bases, which may be
+// nil when no thin pack is expected. It returns the pack name.
+func WritePack(reader io.Reader, dir string, bases BaseReader, progressOutput io.Writer) (string, error) {
+	file, err := os.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	output := bufio.NewWriter(file)
+	receiving := progress.New(progressOutput, "Receiving objects", 0)
+	objects, entries, checksum, err := scanPack(newPackReader(reader, output), receiving)
+	if err != nil {
+		return "", err
+	}
+	if err := output.Flush(); err != nil {
+		return "", err
+	}
+	receiving.Done()
+
+	resolver := newResolver(&Packfile{file: file}, objects, entries, progressOutput)
+	if err := resolver.resolveRoots(resolver.roots()); err != nil {
+		return "", err
+	}
+	if checksum, err = resolver.completeThinPack(file, bases, checksum); err != nil {
+		return "", err
+	}
+	if err := resolver.finish(); err != nil {
+		return "", err
+	}
+	entries = resolver.entries
+
+	packName := hex.EncodeToString(checksum)
+	packPath := filepath.Join(dir, fmt.Sprintf("pack-%s.pack", packName))
+	if err := file.Chmod(0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(file.Name(), packPath); err != nil {
+		return "", err
+	}
+	// The .idx is written last: a pack is only used once its index exists.
+	return packName, writeIndexAtomic(strings.TrimSuffix(packPath, ".pack")+".idx", entries, checksum)
+}
+
+func writeIndexAtomic(indexPath string, entries []IndexEntry, packChecksum []byte) error {
+	tmpPath := indexPath + ".tmp"
+	if err := WriteIndex(tmpPath, entries, packChecksum); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, indexPath)
+}
+
+func WriteIndex(indexPath string, entries []IndexEntry, packChecksum []byte) error {
+	sorted := make([]IndexEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].sha1Hash, sorted[j].sha1Hash) < 0 })
+
+	index := bytes.Buffer{}
+	index.Write([]byte{0xFF, 't', 'O', 'c'})
+	index.Write(uint32BigEndian(2))
+
+	var fanout [256]uint32
+	for _, entry := range sorted {
+		fanout[entry.sha1Hash[0]]++
+	}
+	var total uint32
+	for _, count := range fanout {
+		total += count
+		index.Write(uint32BigEndian(total))
+	}
+
+	for _, entry := range sorted {
+		index.Write(entry.sha1Hash)
+	}
+	for _, entry := range sorted {
+		index.Write(uint32BigEndian(entry.crc))
+	}
+
+	largeOffsets := bytes.Buffer{}
+	var numLargeOffsets uint32
+	for _, entry := range sorted {
+		if entry.offset < 0x80000000 {
+			index.Write(uint32BigEndian(uint32(entry.offset)))
+			continue
+		}
+		index.Write(uint32BigEndian(0x80000000 | numLargeOffsets))
+		largeOffsets.Write(uint32BigEndian(uint32(entry.offset >> 32)))
+		largeOffsets.Write(uint32BigEndian(uint32(entry.offset)))
+		numLargeOffsets++
+	}
+	index.Write(largeOffsets.Bytes())
+
+	index.Write(packChecksum)
+	indexChecksum := sha1.Sum(index.Bytes())
+	index.Write(indexChecksum[:])
+
+	return os.WriteFile(indexPath, index.Bytes(), 0444)
+}
@@ -0,0 +1,170 @@
+// Package packfile reads, indexes and resolves git packfiles and their
+// version 2 .idx files.
+package packfile
+
+import (
+	"bytes"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+const (
+	META_DATA_END    = 12
+	CHECK_SUM_LENGTH = 20
+)
+
+// Entry is a single object as stored in a pack. data holds the inflated
+// payload, not undeltified, when the entry was read back with readEntry.
+type Entry struct {
+	offset     int
+	end        int
+	objectType object.ObjectType
+	// size is the inflated size recorded in the entry header.
+	size       int
+	baseObject string
+	baseOffset int
+	data       []byte
+}
+
+func readObjectHeader(packfile []byte) (size uint64, objectType object.ObjectType, used int, err error) {
+	if len(packfile) == 0 {
+		return 0, object.ObjectType(0), 0, badPackfile("bad object header")
+	}
+	data := packfile[used]
+	used++
+	objectType = object.ObjectType((data >> 4) & 0x7)
+	size = uint64(data & 0xF)
+	shift := 4
+
+	for data&0x80 != 0 {
+		if len(packfile) <= used || 64 <= shift {
+			return 0, object.ObjectType(0), 0, badPackfile("bad object header")
+		}
+		data = packfile[used]
+		used++
+		size += uint64(data&0x7F) << shift
+		shift += 7
+	}
+	return size, objectType, used, nil
+}
+
+// encodeObjectHeader encodes the type and inflated size that start a pack
+// entry, the reverse of readObjectHeader.
+func encodeObjectHeader(objectType object.ObjectType, size uint64) []byte {
+	header := []byte{byte(objectType)<<4 | byte(size&0xF)}
+	size >>= 4
+	for size > 0 {
+		header[len(header)-1] |= 0x80
+		header = append(header, byte(size&0x7F))
+		size >>= 7
+	}
+	return header
+}
+
+func readSize(packfile []byte) (size uint64, used int, err error) {
+	if len(packfile) == 0 {
+		return 0, 0, badPackfile("bad delta size")
+	}
+	data := packfile[used]
+	used++
+	size = uint64(data & 0x7F)
+	shift := 7
+
+	for data&0x80 != 0 {
+		if len(packfile) <= used || 64 <= shift {
+			return 0, 0, badPackfile("bad delta size")
+		}
+		data = packfile[used]
+		used++
+		size += uint64(data&0x7F) << shift
+		shift += 7
+	}
+	return size, used, nil
+}
+
+func readOffset(packfile []byte) (offset uint64, used int, err error) {
+	if len(packfile) == 0 {
+		return 0, 0, badPackfile("bad delta base offset")
+	}
+	data := packfile[used]
+	used++
+	offset = uint64(data & 0x7F)
+
+	for data&0x80 != 0 {
+		if len(packfile) <= used || 64 <= used*7 {
+			return 0, 0, badPackfile("bad delta base offset")
+		}
+		data = packfile[used]
+		used++
+		offset = ((offset + 1) << 7) | uint64(data&0x7F)
+	}
+	return offset, used, nil
+}
+
+func ApplyDelta(baseObject, deltaObject []byte) ([]byte, error) {
+	used := 0
+	baseSize, read, err := readSize(deltaObject[used:])
+	used += read
+	if err != nil {
+		return nil, err
+	}
+	if len(baseObject) != int(baseSize) {
+		return nil, badPackfile("bad delta header")
+	}
+
+	expectedSize, read, err := readSize(deltaObject[used:])
+	used += read
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.Buffer{}
+	for used < len(deltaObject) {
+		opcode := deltaObject[used]
+		used++
+
+		if opcode&0x80 != 0 {
+			var argument uint64
+			for bit := 0; bit < 7; bit++ {
+				if opcode&(1<<bit) != 0 {
+					if used >= len(deltaObject) {
+						return nil, badPackfile("bad delta copy instruction")
+					}
+					argument += uint64(deltaObject[used]) << (bit * 8)
+					used++
+				}
+			}
+			offset := argument & 0xFFFFFFFF
+			size := (argument >> 32) & 0xFFFFFF
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(baseObject)) {
+				return nil, badPackfile("bad delta copy instruction")
+			}
+			buffer.Write(baseObject[offset : offset+size])
+		} else {
+			size := int(opcode & 0x7F)
+			if size == 0 || used+size > len(deltaObject) {
+				return nil, badPackfile("bad delta insert instruction")
+			}
+			buffer.Write(deltaObject[used : used+size])
+			used += size
+		}
+	}
+
+	undeltifiedObject := buffer.Bytes()
+	if int(expectedSize) != len(undeltifiedObject) {
+		return nil, badPackfile("bad delta header")
+	}
+
+	return undeltifiedObject, nil
+}
+
+func readUint32BigEndian(bytes []byte) uint32 {
+	return uint32(bytes[0])<<24 | uint32(bytes[1])<<16 | uint32(bytes[2])<<8 | uint32(bytes[3])
+}
+
+func uint32BigEndian(value uint32) []byte {
+	return []byte{byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}
+}
@@ -0,0 +1,388 @@
+package packfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// BaseReader looks up REF_DELTA bases that are not in the pack itself.
+type BaseReader interface {
+	Read(objectName string) ([]byte, string, error)
+	Stat(objectName string) (string, int, error)
+}
+
+// Packfile is an open .pack file together with its .idx.
+type Packfile struct {
+	path       string
+	file       *os.File
+	index      []byte
+	numObjects int
+
+	// byOffset holds the index positions sorted by pack offset, built the
+	// first time DiskInfo needs it.
+	byOffsetOnce sync.Once
+	byOffset     []int
+}
+
+const MAX_DELTA_CHAIN = 10000
+
+func Open(indexPath string) (*Packfile, error) {
+	index, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(index) < 8+256*4+2*CHECK_SUM_LENGTH || !bytes.Equal(index[:4], []byte{0xFF, 't', 'O', 'c'}) {
+		return nil, badPackfile("bad pack index %s", indexPath)
+	}
+	if readUint32BigEndian(index[4:8]) != 2 {
+		return nil, badPackfile("unsupported pack index version in %s", indexPath)
+	}
+
+	// The fanout table counts the names up to each first byte, so it never
+	// decreases, and its last entry is the number of objects.
+	numObjects := int(readUint32BigEndian(index[8+255*4:]))
+	for i := 1; i < 256; i++ {
+		if readUint32BigEndian(index[8+(i-1)*4:]) > readUint32BigEndian(index[8+i*4:]) {
+			return nil, badPackfile("pack index %s has a bad fanout table", indexPath)
+		}
+	}
+
+	// The index holds a name, a CRC32 and a 32-bit offset per object, and
+	// a 64-bit offset for each 32-bit offset with its top bit set.
+	offsetsOffset := 8 + 256*4 + numObjects*(object.SHA1_HASH_LENGTH+4)
+	minSize := offsetsOffset + numObjects*4 + 2*CHECK_SUM_LENGTH
+	if len(index) < minSize {
+		return nil, badPackfile("truncated pack index %s", indexPath)
+	}
+	largeOffsets := 0
+	for i := 0; i < numObjects; i++ {
+		if readUint32BigEndian(index[offsetsOffset+i*4:])&0x80000000 != 0 {
+			largeOffsets++
+		}
+	}
+	if len(index) != minSize+largeOffsets*8 {
+		return nil, badPackfile("pack index %s has the wrong size", indexPath)
+	}
+	for i := 0; i < numObjects; i++ {
+		offset := readUint32BigEndian(index[offsetsOffset+i*4:])
+		if offset&0x80000000 != 0 && int(offset&0x7FFFFFFF) >= largeOffsets {
+			return nil, badPackfile("pack index %s has a bad offset", indexPath)
+		}
+	}
+
+	file, err := os.Open(strings.TrimSuffix(indexPath, ".idx") + ".pack")
+	if err != nil {
+		return nil, err
+	}
+	return &Packfile{
+		path:       indexPath,
+		file:       file,
+		index:      index,
+		numObjects: numObjects,
+	}, nil
+}
+
+func (p *Packfile) Path() string {
+	return p.path
+}
+
+func (p *Packfile) NumObjects() int {
+	return p.numObjects
+}
+
+func (p *Packfile) Close() error {
+	return p.file.Close()
+}
+
+// ObjectName returns the i-th object name in index order.
+func (p *Packfile) ObjectName(i int) string {
+	start := 8 + 256*4 + i*object.SHA1_HASH_LENGTH
+	return hex.EncodeToString(p.index[start : start+object.SHA1_HASH_LENGTH])
+}
+
+// FanoutRange returns the range of index positions whose names start with
+// the byte first.
+func (p *Packfile) FanoutRange(first byte) (int, int) {
+	fanout := 8
+	lo := 0
+	if first > 0 {
+		lo = int(readUint32BigEndian(p.index[fanout+(int(first)-1)*4:]))
+	}
+	hi := int(readUint32BigEndian(p.index[fanout+int(first)*4:]))
+	return lo, hi
+}
+
+func (p *Packfile) FindOffset(name []byte) (uint64, bool) {
+	lo, hi := p.FanoutRange(name[0])
+	fanout := 8
+	namesOffset := fanout + 256*4
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		start := namesOffset + (lo+i)*object.SHA1_HASH_LENGTH
+		return bytes.Compare(p.index[start:start+object.SHA1_HASH_LENGTH], name) >= 0
+	})
+	start := namesOffset + i*object.SHA1_HASH_LENGTH
+	if i == hi || !bytes.Equal(p.index[start:start+object.SHA1_HASH_LENGTH], name) {
+		return 0, false
+	}
+
+	return p.offsetAt(i), true
+}
+
+// offsetAt returns the pack offset of the i-th object in index order.
+func (p *Packfile) offsetAt(i int) uint64 {
+	offsetsOffset := 8 + 256*4 + p.numObjects*(object.SHA1_HASH_LENGTH+4)
+	offset := uint64(readUint32BigEndian(p.index[offsetsOffset+i*4:]))
+	if offset&0x80000000 != 0 {
+		largeOffset := offsetsOffset + p.numObjects*4 + int(offset&0x7FFFFFFF)*8
+		offset = uint64(readUint32BigEndian(p.index[largeOffset:]))<<32 | uint64(readUint32BigEndian(p.index[largeOffset+4:]))
+	}
+	return offset
+}
+
+// DiskInfo returns the number of bytes the entry at offset takes up in the
+// pack, header included, and the name of its delta base, which is "" when
+// the entry is not a delta.
+func (p *Packfile) DiskInfo(offset uint64) (int64, string, error) {
+	p.byOffsetOnce.Do(func() {
+		p.byOffset = make([]int, p.numObjects)
+		for i := range p.byOffset {
+			p.byOffset[i] = i
+		}
+		sort.Slice(p.byOffset, func(a, b int) bool {
+			return p.offsetAt(p.byOffset[a]) < p.offsetAt(p.byOffset[b])
+		})
+	})
+
+	info, err := p.file.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+	end := uint64(info.Size() - CHECK_SUM_LENGTH)
+	next := sort.Search(len(p.byOffset), func(i int) bool { return p.offsetAt(p.byOffset[i]) > offset })
+	if next < len(p.byOffset) {
+		end = p.offsetAt(p.byOffset[next])
+	}
+	if end <= offset {
+		return 0, "", badPackfile("bad pack offset")
+	}
+
+	entry, _, err := p.readEntryHeader(offset)
+	if err != nil {
+		return 0, "", err
+	}
+	base := entry.baseObject
+	if entry.objectType == object.OBJ_OFS_DELTA {
+		i := sort.Search(len(p.byOffset), func(i int) bool { return p.offsetAt(p.byOffset[i]) >= uint64(entry.baseOffset) })
+		if i == len(p.byOffset) || p.offsetAt(p.byOffset[i]) != uint64(entry.baseOffset) {
+			return 0, "", badPackfile("bad delta base offset")
+		}
+		base = p.ObjectName(p.byOffset[i])
+	}
+	return int64(end - offset), base, nil
+}
+
+// readEntryHeader reads the type, size and delta base of the entry at
+// offset, returning how many bytes they take up before the zlib data.
+func (p *Packfile) readEntryHeader(offset uint64) (Entry, int, error) {
+	entry := Entry{offset: int(offset)}
+
+	// An entry header is at most a 10 byte size and a 20 byte base name,
+	// and every entry is followed by at least the pack checksum.
+	header := make([]byte, 64)
+	n, err := p.file.ReadAt(header, int64(offset))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return entry, 0, err
+	}
+	header = header[:n]
+	if len(header) < 2 {
+		return entry, 0, badPackfile("bad pack offset")
+	}
+
+	size, objectType, used, err := readObjectHeader(header)
+	if err != nil {
+		return entry, 0, err
+	}
+	entry.objectType = objectType
+	entry.size = int(size)
+
+	switch objectType {
+	case object.OBJ_COMMIT, object.OBJ_TREE, object.OBJ_BLOB, object.OBJ_TAG:
+
+	case object.OBJ_OFS_DELTA:
+		negativeOffset, read, err := readOffset(header[used:])
+		used += read
+		if err != nil {
+			return entry, 0, err
+		}
+		if negativeOffset == 0 || offset < negativeOffset {
+			return entry, 0, badPackfile("bad delta base offset")
+		}
+		entry.baseOffset = int(offset - negativeOffset)
+
+	case object.OBJ_REF_DELTA:
+		if used+object.SHA1_HASH_LENGTH > len(header) {
+			return entry, 0, badPackfile("bad delta base object")
+		}
+		entry.baseObject = hex.EncodeToString(header[used : used+object.SHA1_HASH_LENGTH])
+		used += object.SHA1_HASH_LENGTH
+
+	default:
+		return entry, 0, badPackfile("invalid object type")
+	}
+	return entry, used, nil
+}
+
+func (p *Packfile) readEntry(offset uint64) (Entry, error) {
+	entry, used, err := p.readEntryHeader(offset)
+	if err != nil {
+		return entry, err
+	}
+
+	reader, err := zlib.NewReader(bufio.NewReader(io.NewSectionReader(p.file, int64(offset)+int64(used), 1<<62)))
+	if err != nil {
+		return entry, err
+	}
+	defer reader.Close()
+
+	entry.data, err = io.ReadAll(reader)
+	if err != nil {
+		return entry, err
+	}
+	if entry.size != len(entry.data) {
+		return entry, badPackfile("object size does not match header")
+	}
+	return entry, nil
+}
+
+// ReadObjectAt walks a delta chain down to its base, which may live outside
+// this pack for REF_DELTA entries, and then applies the deltas back up.
+func (p *Packfile) ReadObjectAt(offset uint64, bases BaseReader) ([]byte, string, error) {
+	deltas := [][]byte{}
+	var data []byte
+	var objectType string
+
+	for data == nil {
+		if len(deltas) > MAX_DELTA_CHAIN {
+			return nil, "", badPackfile("delta chain too long")
+		}
+		entry, err := p.readEntry(offset)
+		if err != nil {
+			return nil, "", err
+		}
+
+		switch entry.objectType {
+		case object.OBJ_OFS_DELTA:
+			deltas = append(deltas, entry.data)
+			offset = uint64(entry.baseOffset)
+
+		case object.OBJ_REF_DELTA:
+			deltas = append(deltas, entry.data)
+			baseName, _ := hex.DecodeString(entry.baseObject)
+			if baseOffset, ok := p.FindOffset(baseName); ok {
+				offset = baseOffset
+				continue
+			}
+			if bases == nil {
+				return nil, "", badPackfile("missing delta base %s", entry.baseObject)
+			}
+			data, objectType, err = bases.Read(entry.baseObject)
+			if err != nil {
+				return nil, "", badPackfile("missing delta base %s: %v", entry.baseObject, err)
+			}
+
+		default:
+			data = entry.data
+			objectType = object.TypeString(entry.objectType)
+		}
+	}
+
+	for i := len(deltas) - 1; i >= 0; i-- {
+		var err error
+		data, err = ApplyDelta(data, deltas[i])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return data, objectType, nil
+}
+
+// StatAt finds the type at the bottom of a delta chain and the size from the
+// result size recorded in the outermost delta, reading only entry headers
+// and the start of that delta, without applying any deltas.
+func (p *Packfile) StatAt(offset uint64, bases BaseReader) (string, int, error) {
+	size := -1
+	for i := 0; i <= MAX_DELTA_CHAIN; i++ {
+		entry, used, err := p.readEntryHeader(offset)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if size < 0 && (entry.objectType == object.OBJ_OFS_DELTA || entry.objectType == object.OBJ_REF_DELTA) {
+			if size, err = p.readResultSize(offset + uint64(used)); err != nil {
+				return "", 0, err
+			}
+		}
+
+		switch entry.objectType {
+		case object.OBJ_OFS_DELTA:
+			offset = uint64(entry.baseOffset)
+
+		case object.OBJ_REF_DELTA:
+			baseName, _ := hex.DecodeString(entry.baseObject)
+			if baseOffset, ok := p.FindOffset(baseName); ok {
+				offset = baseOffset
+				continue
+			}
+			if bases == nil {
+				return "", 0, badPackfile("missing delta base %s", entry.baseObject)
+			}
+			objectType, baseSize, err := bases.Stat(entry.baseObject)
+			if size < 0 {
+				size = baseSize
+			}
+			return objectType, size, err
+
+		default:
+			if size < 0 {
+				size = entry.size
+			}
+			return object.TypeString(entry.objectType), size, nil
+		}
+	}
+	return "", 0, badPackfile("delta chain too long")
+}
+
+// readResultSize inflates the start of the delta data at offset, just
+// enough for the base and result sizes it begins with, and returns the
+// result size.
+func (p *Packfile) readResultSize(offset uint64) (int, error) {
+	reader, err := zlib.NewReader(io.NewSectionReader(p.file, int64(offset), 1<<62))
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	// Each size takes at most 10 bytes.
+	header := make([]byte, 20)
+	n, err := io.ReadFull(reader, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, err
+	}
+	header = header[:n]
+	_, read, err := readSize(header)
+	if err != nil {
+		return 0, err
+	}
+	resultSize, _, err := readSize(header[read:])
+	return int(resultSize), err
+}
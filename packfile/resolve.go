@@ -0,0 +1,262 @@
+package packfile
+
+import (
+	"encoding/hex"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/progress"
+)
+
+// DELTA_BASE_CACHE_LIMIT bounds the bytes of undeltified bases the
+// resolver keeps around, shared evenly between its workers. Bases evicted
+// from the cache are rebuilt from the pack when another delta needs them.
+const DELTA_BASE_CACHE_LIMIT = 96 << 20
+
+// resolveFrame is an object on the path from a base to the delta being
+// resolved. data is nil once it has been evicted from the cache.
+type resolveFrame struct {
+	index      int
+	objectType string
+	data       []byte
+	children   []int
+	next       int
+}
+
+// resolver names the deltas of a pack by walking, depth first, the graph
+// from each base to the deltas made against it. Each delta is read from
+// the pack and applied once.
+type resolver struct {
+	pack    *Packfile
+	objects []Entry
+	entries []IndexEntry
+
+	// ofsChildren and refChildren map a base's offset or name to the
+	// deltas that use it.
+	ofsChildren map[int][]int
+	refChildren map[string][]int
+	cacheLimit  int
+	numDeltas   int
+
+	mu          sync.Mutex
+	numResolved int
+	meter       *progress.Meter
+}
+
+// newResolver maps every base in objects to the deltas made against it.
+func newResolver(pack *Packfile, objects []Entry, entries []IndexEntry, progressOutput io.Writer) *resolver {
+	r := &resolver{
+		pack:        pack,
+		objects:     objects,
+		entries:     entries,
+		ofsChildren: map[int][]int{},
+		refChildren: map[string][]int{},
+	}
+
+	numDeltas := 0
+	for i, entry := range objects {
+		switch entry.objectType {
+		case object.OBJ_OFS_DELTA:
+			r.ofsChildren[entry.baseOffset] = append(r.ofsChildren[entry.baseOffset], i)
+			numDeltas++
+		case object.OBJ_REF_DELTA:
+			r.refChildren[entry.baseObject] = append(r.refChildren[entry.baseObject], i)
+			numDeltas++
+		}
+	}
+	r.meter = progress.New(progressOutput, "Resolving deltas", numDeltas)
+	r.numDeltas = numDeltas
+	return r
+}
+
+// resolveDeltas names every delta in entries, undeltifying against bases
+// found earlier or later in the same pack.
+func resolveDeltas(pack *Packfile, objects []Entry, entries []IndexEntry, progressOutput io.Writer) error {
+	r := newResolver(pack, objects, entries, progressOutput)
+	if err := r.resolveRoots(r.roots()); err != nil {
+		return err
+	}
+	return r.finish()
+}
+
+// roots returns the objects that are not deltas but are the base of one.
+func (r *resolver) roots() []int {
+	roots := []int{}
+	for i := range r.objects {
+		if r.entries[i].sha1Hash != nil && len(r.children(i)) > 0 {
+			roots = append(roots, i)
+		}
+	}
+	return roots
+}
+
+// resolveRoots resolves the deltas below each of roots. Subtrees below
+// different roots are resolved concurrently.
+func (r *resolver) resolveRoots(roots []int) error {
+	if len(roots) == 0 {
+		return nil
+	}
+	numWorkers := min(runtime.NumCPU(), len(roots))
+	r.cacheLimit = DELTA_BASE_CACHE_LIMIT / numWorkers
+	work := make(chan int)
+	errs := make(chan error, numWorkers)
+	for range numWorkers {
+		go func() {
+			var err error
+			for root := range work {
+				if err == nil {
+					err = r.resolveTree(root)
+				}
+			}
+			errs <- err
+		}()
+	}
+	for _, root := range roots {
+		work <- root
+	}
+	close(work)
+
+	var firstErr error
+	for range numWorkers {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// missingBases returns, in sorted order, the REF_DELTA bases whose deltas
+// are still unresolved. Some of them may be the result of other deltas
+// that are unresolved too, rather than missing from the pack.
+func (r *resolver) missingBases() []string {
+	missing := []string{}
+	for baseName := range r.refChildren {
+		if !r.baseResolved(baseName) {
+			missing = append(missing, baseName)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// baseResolved reports whether the deltas made against baseName have been
+// resolved, which they all are once the base is known.
+func (r *resolver) baseResolved(baseName string) bool {
+	return r.entries[r.refChildren[baseName][0]].sha1Hash != nil
+}
+
+// finish checks that every delta was resolved.
+func (r *resolver) finish() error {
+	if r.numResolved != r.numDeltas {
+		return badPackfile("unresolvable delta objects")
+	}
+	r.meter.Done()
+	return nil
+}
+
+// children returns the deltas whose base is the i-th object. The object
+// must already be named.
+func (r *resolver) children(i int) []int {
+	children := r.ofsChildren[r.objects[i].offset]
+	if name := r.entries[i].sha1Hash; name != nil {
+		children = append(children[:len(children):len(children)], r.refChildren[hex.EncodeToString(name)]...)
+	}
+	return children
+}
+
+// resolveTree names every delta reachable from root, keeping the bases on
+// the current path in memory up to the cache limit.
+func (r *resolver) resolveTree(root int) error {
+	entry, err := r.pack.readEntry(uint64(r.objects[root].offset))
+	if err != nil {
+		return err
+	}
+	stack := []*resolveFrame{{
+		index:      root,
+		objectType: object.TypeString(entry.objectType),
+		data:       entry.data,
+		children:   r.children(root),
+	}}
+	cached := len(entry.data)
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if top.next == len(top.children) {
+			cached -= len(top.data)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		child := top.children[top.next]
+		top.next++
+
+		if top.data == nil {
+			if top.data, err = r.rebuild(stack); err != nil {
+				return err
+			}
+			cached += len(top.data)
+		}
+		delta, err := r.pack.readEntry(uint64(r.objects[child].offset))
+		if err != nil {
+			return err
+		}
+		data, err := ApplyDelta(top.data, delta.data)
+		if err != nil {
+			return err
+		}
+		r.entries[child].sha1Hash = object.Hash(top.objectType, data)
+		r.resolved()
+
+		children := r.children(child)
+		if len(children) == 0 {
+			continue
+		}
+		stack = append(stack, &resolveFrame{index: child, objectType: top.objectType, data: data, children: children})
+		cached += len(data)
+
+		// Evict from the bottom of the path: the deepest bases are the
+		// ones the next deltas are most likely to need.
+		for i := 0; cached > r.cacheLimit && i < len(stack)-1; i++ {
+			cached -= len(stack[i].data)
+			stack[i].data = nil
+		}
+	}
+	return nil
+}
+
+// rebuild recomputes the data of the top frame from the nearest frame
+// below it that is still cached, or from the root object in the pack.
+func (r *resolver) rebuild(stack []*resolveFrame) ([]byte, error) {
+	start := len(stack) - 1
+	for start > 0 && stack[start].data == nil {
+		start--
+	}
+	data := stack[start].data
+	if data == nil {
+		entry, err := r.pack.readEntry(uint64(r.objects[stack[0].index].offset))
+		if err != nil {
+			return nil, err
+		}
+		data = entry.data
+	}
+
+	for _, frame := range stack[start+1:] {
+		delta, err := r.pack.readEntry(uint64(r.objects[frame.index].offset))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ApplyDelta(data, delta.data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (r *resolver) resolved() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.numResolved++
+	r.meter.Update(r.numResolved, 0)
+}
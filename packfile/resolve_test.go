@@ -0,0 +1,196 @@
+package packfile
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// buildDeltaChainPack returns a pack of numChains blobs, each followed by
+// depth deltas that alternate between OBJ_OFS_DELTA and OBJ_REF_DELTA,
+// every one made against the previous version of its blob.
+func buildDeltaChainPack(tb testing.TB, numChains, depth int) []byte {
+	tb.Helper()
+	random := rand.New(rand.NewSource(1))
+	pack := &bytes.Buffer{}
+	pack.WriteString("PACK")
+	pack.Write(uint32BigEndian(2))
+	pack.Write(uint32BigEndian(uint32(numChains * (depth + 1))))
+
+	writeEntry := func(header []byte, data []byte) {
+		pack.Write(header)
+		compressor := zlib.NewWriter(pack)
+		compressor.Write(data)
+		compressor.Close()
+	}
+
+	for chain := 0; chain < numChains; chain++ {
+		version := make([]byte, 16*1024)
+		for i := range version {
+			version[i] = byte('a' + random.Intn(26))
+		}
+		baseOffset := pack.Len()
+		writeEntry(encodeObjectHeader(object.OBJ_BLOB, uint64(len(version))), version)
+		baseName := object.Hash("blob", version)
+
+		for i := 0; i < depth; i++ {
+			next := append([]byte{}, version...)
+			copy(next[random.Intn(len(next)-64):], fmt.Sprintf("chain %d version %d", chain, i))
+			delta := CreateDelta(version, next)
+
+			offset := pack.Len()
+			if i%2 == 0 {
+				header := encodeObjectHeader(object.OBJ_OFS_DELTA, uint64(len(delta)))
+				writeEntry(append(header, encodeOffset(uint64(offset-baseOffset))...), delta)
+			} else {
+				header := encodeObjectHeader(object.OBJ_REF_DELTA, uint64(len(delta)))
+				writeEntry(append(header, baseName...), delta)
+			}
+			version, baseOffset, baseName = next, offset, object.Hash("blob", next)
+		}
+	}
+
+	checksum := sha1.Sum(pack.Bytes())
+	pack.Write(checksum[:])
+	return pack.Bytes()
+}
+
+// scanTestPack writes data to a temporary file and scans it, returning the
+// open pack with its entries.
+func scanTestPack(tb testing.TB, data []byte) (*Packfile, []Entry, []IndexEntry) {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "test.pack")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		tb.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { file.Close() })
+
+	objects, entries, _, err := scanPack(newPackReader(bytes.NewReader(data), nil), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &Packfile{file: file}, objects, entries
+}
+
+func TestResolveDeltasMatchesSequentialResolve(t *testing.T) {
+	pack, objects, entries := scanTestPack(t, buildDeltaChainPack(t, 8, 60))
+	if err := resolveDeltas(pack, objects, entries, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resolve again one entry at a time, in pack order, in which every
+	// base comes before its deltas.
+	byOffset, byName := map[int][]byte{}, map[string][]byte{}
+	for i, entry := range objects {
+		read, err := pack.readEntry(uint64(entry.offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := read.data
+		switch read.objectType {
+		case object.OBJ_OFS_DELTA:
+			data, err = ApplyDelta(byOffset[read.baseOffset], read.data)
+		case object.OBJ_REF_DELTA:
+			data, err = ApplyDelta(byName[read.baseObject], read.data)
+		}
+		if err != nil {
+			t.Fatalf("object at offset %d: %v", entry.offset, err)
+		}
+		name := object.Hash("blob", data)
+		byOffset[entry.offset], byName[hex.EncodeToString(name)] = data, data
+
+		if !bytes.Equal(entries[i].sha1Hash, name) {
+			t.Errorf("object at offset %d: resolved as %x, want %x", entry.offset, entries[i].sha1Hash, name)
+		}
+	}
+}
+
+func BenchmarkResolveDeltas(b *testing.B) {
+	pack, objects, scanned := scanTestPack(b, buildDeltaChainPack(b, 4, 500))
+	entries := make([]IndexEntry, len(scanned))
+	for b.Loop() {
+		copy(entries, scanned)
+		if err := resolveDeltas(pack, objects, entries, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// testBases is a BaseReader over a map of blobs.
+type testBases map[string][]byte
+
+func (b testBases) Read(objectName string) ([]byte, string, error) {
+	data, ok := b[objectName]
+	if !ok {
+		return nil, "", object.NotFound(objectName)
+	}
+	return data, "blob", nil
+}
+
+func (b testBases) Stat(objectName string) (string, int, error) {
+	data, _, err := b.Read(objectName)
+	return "blob", len(data), err
+}
+
+func TestWritePackCompletesThinPackFromDeltaBases(t *testing.T) {
+	// The pack holds two REF_DELTAs: one against a blob it leaves out,
+	// and one against the result of the first.
+	external := bytes.Repeat([]byte("external base\n"), 20)
+	first := append(append([]byte{}, external...), "first\n"...)
+	second := append(append([]byte{}, first...), "second\n"...)
+
+	pack := &bytes.Buffer{}
+	pack.WriteString("PACK")
+	pack.Write(uint32BigEndian(2))
+	pack.Write(uint32BigEndian(2))
+	for _, delta := range []struct{ base, target []byte }{{first, second}, {external, first}} {
+		data := CreateDelta(delta.base, delta.target)
+		pack.Write(encodeObjectHeader(object.OBJ_REF_DELTA, uint64(len(data))))
+		pack.Write(object.Hash("blob", delta.base))
+		compressor := zlib.NewWriter(pack)
+		compressor.Write(data)
+		compressor.Close()
+	}
+	checksum := sha1.Sum(pack.Bytes())
+	pack.Write(checksum[:])
+
+	dir := t.TempDir()
+	bases := testBases{hex.EncodeToString(object.Hash("blob", external)): external}
+	packName, err := WritePack(bytes.NewReader(pack.Bytes()), dir, bases, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := Open(filepath.Join(dir, "pack-"+packName+".idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer written.Close()
+	if written.NumObjects() != 3 {
+		t.Errorf("completed pack has %d objects, want 3", written.NumObjects())
+	}
+	for _, want := range [][]byte{external, first, second} {
+		offset, ok := written.FindOffset(object.Hash("blob", want))
+		if !ok {
+			t.Fatalf("completed pack is missing %x", object.Hash("blob", want))
+		}
+		data, _, err := written.ReadObjectAt(offset, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("object at offset %d does not match", offset)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package packfile
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/progress"
+)
+
+// packReader reads a pack stream, copying every byte to output and feeding
+// it to the running pack checksum and the CRC32 of the current entry. It
+// implements io.ByteReader so zlib never reads past the end of an entry.
+// Bytes are hashed and copied a buffer at a time, when the buffer is
+// refilled or flush is called, rather than as each one is read.
+type packReader struct {
+	reader io.Reader
+	output io.Writer
+	hash   hash.Hash
+	crc    hash.Hash32
+	offset int
+
+	// buffer[start:next] has been read but not yet consumed, and
+	// buffer[next:end] has not been read.
+	buffer           []byte
+	start, next, end int
+}
+
+func newPackReader(reader io.Reader, output io.Writer) *packReader {
+	return &packReader{
+		reader: reader,
+		output: output,
+		hash:   sha1.New(),
+		crc:    crc32.NewIEEE(),
+		buffer: make([]byte, 64*1024),
+	}
+}
+
+// flush feeds the bytes read since the last flush to the checksums and
+// output. It must be called before either checksum is used.
+func (r *packReader) flush() error {
+	data := r.buffer[r.start:r.next]
+	r.start = r.next
+	if len(data) == 0 {
+		return nil
+	}
+	r.hash.Write(data)
+	r.crc.Write(data)
+	if r.output == nil {
+		return nil
+	}
+	_, err := r.output.Write(data)
+	return err
+}
+
+func (r *packReader) fill() error {
+	if err := r.flush(); err != nil {
+		return err
+	}
+	r.start, r.next, r.end = 0, 0, 0
+	for r.end == 0 {
+		n, err := r.reader.Read(r.buffer)
+		r.end = n
+		if n == 0 && err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *packReader) ReadByte() (byte, error) {
+	if r.next == r.end {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	b := r.buffer[r.next]
+	r.next++
+	r.offset++
+	return b, nil
+}
+
+func (r *packReader) Read(p []byte) (int, error) {
+	if r.next == r.end {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buffer[r.next:r.end])
+	r.next += n
+	r.offset += n
+	return n, nil
+}
+
+func (r *packReader) readFull(n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, badPackfile("truncated packfile")
+	}
+	return data, nil
+}
+
+// readVarint reads the bytes of a size or offset encoding, up to and
+// including the first byte without the continuation bit.
+func (r *packReader) readVarint() ([]byte, error) {
+	encoded := []byte{}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, badPackfile("truncated packfile")
+		}
+		encoded = append(encoded, b)
+		if b&0x80 == 0 || len(encoded) > 10 {
+			return encoded, nil
+		}
+	}
+}
+
+// scanPack parses a pack from reader one entry at a time, keeping only the
+// entry headers in memory. Entries that are not deltas are named as they
+// are inflated; deltas are left with a nil name for resolveDeltas. It
+// returns the entries in pack order with their index records, and the pack
+// checksum after checking it against the trailer.
+func scanPack(reader *packReader, meter *progress.Meter) ([]Entry, []IndexEntry, []byte, error) {
+	header, err := reader.readFull(META_DATA_END)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !bytes.Equal(header[0:4], []byte("PACK")) {
+		return nil, nil, nil, badPackfile("invalid packfile header")
+	}
+	version := readUint32BigEndian(header[4:8])
+	if version != 2 && version != 3 {
+		return nil, nil, nil, badPackfile("invalid packfile version")
+	}
+
+	numObjects := int(readUint32BigEndian(header[8:]))
+	meter.SetTotal(numObjects)
+	// The count in the header is not trusted to size anything up front.
+	objects := make([]Entry, 0, min(numObjects, 1<<16))
+	entries := make([]IndexEntry, 0, min(numObjects, 1<<16))
+
+	for len(objects) < numObjects {
+		if err := reader.flush(); err != nil {
+			return nil, nil, nil, err
+		}
+		reader.crc.Reset()
+		entry := Entry{offset: reader.offset}
+
+		encoded, err := reader.readVarint()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		size, objectType, _, err := readObjectHeader(encoded)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		entry.objectType = objectType
+
+		switch objectType {
+		case object.OBJ_COMMIT, object.OBJ_TREE, object.OBJ_BLOB, object.OBJ_TAG:
+
+		case object.OBJ_OFS_DELTA:
+			encoded, err := reader.readVarint()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			negativeOffset, _, err := readOffset(encoded)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if negativeOffset == 0 || uint64(entry.offset) < negativeOffset {
+				return nil, nil, nil, badPackfile("bad delta base offset")
+			}
+			entry.baseOffset = entry.offset - int(negativeOffset)
+
+		case object.OBJ_REF_DELTA:
+			baseName, err := reader.readFull(object.SHA1_HASH_LENGTH)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			entry.baseObject = hex.EncodeToString(baseName)
+
+		default:
+			return nil, nil, nil, badPackfile("invalid object type")
+		}
+
+		// Name whole objects while they are inflated; delta payloads are
+		// only checked against their size and read back when resolving.
+		var objectHash hash.Hash
+		inflated := io.Discard
+		if entry.objectType != object.OBJ_OFS_DELTA && entry.objectType != object.OBJ_REF_DELTA {
+			objectHash = sha1.New()
+			fmt.Fprintf(objectHash, "%s %d\x00", object.TypeString(entry.objectType), size)
+			inflated = objectHash
+		}
+
+		inflater, err := zlib.NewReader(reader)
+		if err != nil {
+			return nil, nil, nil, badPackfile("bad compressed object at offset %d", entry.offset)
+		}
+		n, err := io.Copy(inflated, inflater)
+		if err == nil {
+			err = inflater.Close()
+		}
+		if err != nil {
+			return nil, nil, nil, badPackfile("bad compressed object at offset %d", entry.offset)
+		}
+		if uint64(n) != size {
+			return nil, nil, nil, badPackfile("object size does not match header")
+		}
+
+		if err := reader.flush(); err != nil {
+			return nil, nil, nil, err
+		}
+		entry.end = reader.offset
+		indexEntry := IndexEntry{offset: uint64(entry.offset), crc: reader.crc.Sum32()}
+		if objectHash != nil {
+			indexEntry.sha1Hash = objectHash.Sum(nil)
+		}
+		objects = append(objects, entry)
+		entries = append(entries, indexEntry)
+		meter.Update(len(objects), int64(reader.offset))
+	}
+
+	if err := reader.flush(); err != nil {
+		return nil, nil, nil, err
+	}
+	checksum := reader.hash.Sum(nil)
+	trailer, err := reader.readFull(CHECK_SUM_LENGTH)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := reader.flush(); err != nil {
+		return nil, nil, nil, err
+	}
+	if !bytes.Equal(trailer, checksum) {
+		return nil, nil, nil, badPackfile("invalid packfile checksum")
+	}
+	return objects, entries, checksum, nil
+}
@@ -0,0 +1,23 @@
+package packfile
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"testing"
+)
+
+func TestWritePackRejectsOverstatedObjectCount(t *testing.T) {
+	// An empty pack whose header claims 0xffffffff objects.
+	pack := &bytes.Buffer{}
+	pack.WriteString("PACK")
+	pack.Write(uint32BigEndian(2))
+	pack.Write(uint32BigEndian(0xffffffff))
+	checksum := sha1.Sum(pack.Bytes())
+	pack.Write(checksum[:])
+
+	_, err := WritePack(bytes.NewReader(pack.Bytes()), t.TempDir(), nil, nil)
+	if !errors.Is(err, ErrBadPackfile) {
+		t.Fatalf("WritePack returned %v, want %v", err, ErrBadPackfile)
+	}
+}
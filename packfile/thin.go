@@ -0,0 +1,95 @@
+package packfile
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// completeThinPack appends to a thin pack the REF_DELTA bases it was sent
+// without, read from bases, and resolves the deltas made against them. The
+// object count in the header and the trailing checksum are rewritten, so
+// the pack stands on its own. It returns the new checksum, or checksum
+// unchanged when nothing was missing.
+//
+// Like git's index-pack --fix-thin, each base is resolved as soon as it is
+// appended. A base that is the result of another delta in the pack is then
+// named before its turn comes, and is not taken from bases.
+func (r *resolver) completeThinPack(file *os.File, bases BaseReader, checksum []byte) ([]byte, error) {
+	missing := r.missingBases()
+	if len(missing) == 0 || bases == nil {
+		return checksum, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - CHECK_SUM_LENGTH
+	appended := false
+	readErrs := map[string]error{}
+	for _, baseName := range missing {
+		if r.baseResolved(baseName) {
+			continue
+		}
+		data, objectType, err := bases.Read(baseName)
+		if err != nil {
+			// A delta made against a later base may still produce it.
+			readErrs[baseName] = err
+			continue
+		}
+		name := object.Hash(objectType, data)
+		if hex.EncodeToString(name) != baseName {
+			return nil, badPackfile("delta base %s does not match its content", baseName)
+		}
+
+		entry := bytes.Buffer{}
+		entry.Write(encodeObjectHeader(object.ParseType(objectType), uint64(len(data))))
+		deflater := zlib.NewWriter(&entry)
+		if _, err := deflater.Write(data); err != nil {
+			return nil, err
+		}
+		if err := deflater.Close(); err != nil {
+			return nil, err
+		}
+		if _, err := file.WriteAt(entry.Bytes(), offset); err != nil {
+			return nil, err
+		}
+
+		root := len(r.objects)
+		r.objects = append(r.objects, Entry{offset: int(offset), end: int(offset) + entry.Len(), objectType: object.ParseType(objectType)})
+		r.entries = append(r.entries, IndexEntry{sha1Hash: name, offset: uint64(offset), crc: crc32.ChecksumIEEE(entry.Bytes())})
+		offset += int64(entry.Len())
+		appended = true
+		if err := r.resolveRoots([]int{root}); err != nil {
+			return nil, err
+		}
+	}
+	for _, baseName := range missing {
+		if !r.baseResolved(baseName) {
+			return nil, badPackfile("missing delta base %s: %v", baseName, readErrs[baseName])
+		}
+	}
+	if !appended {
+		return checksum, nil
+	}
+
+	if _, err := file.WriteAt(uint32BigEndian(uint32(len(r.objects))), 8); err != nil {
+		return nil, err
+	}
+	hash := sha1.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, 0, offset)); err != nil {
+		return nil, err
+	}
+	checksum = hash.Sum(nil)
+	if _, err := file.WriteAt(checksum, offset); err != nil {
+		return nil, err
+	}
+	return checksum, nil
+}
@@ -0,0 +1,293 @@
+package packfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/progress"
+)
+
+const (
+	// DEFAULT_WINDOW and DEFAULT_DEPTH are git's pack.window and
+	// pack.depth defaults.
+	DEFAULT_WINDOW = 10
+	DEFAULT_DEPTH  = 50
+	// MIN_DELTA_SIZE is the smallest object worth storing as a delta.
+	MIN_DELTA_SIZE = 50
+)
+
+// PackObject is an object to write to a pack. Path is where the object was
+// found in a tree, if anywhere; objects with similar paths are tried as
+// delta bases for each other first.
+type PackObject struct {
+	Name string
+	Path string
+}
+
+// PackOptions control delta compression when writing a pack.
+type PackOptions struct {
+	// Window is how many of the objects sorted before an object are tried
+	// as its delta base. With 0 every object is stored whole.
+	Window int
+	// Depth is the longest delta chain allowed.
+	Depth int
+	// OffsetDeltas stores deltas as OBJ_OFS_DELTA, which readers must
+	// support, rather than OBJ_REF_DELTA.
+	OffsetDeltas bool
+}
+
+// DefaultPackOptions returns git's default window and depth.
+func DefaultPackOptions() PackOptions {
+	return PackOptions{Window: DEFAULT_WINDOW, Depth: DEFAULT_DEPTH}
+}
+
+// packEntry is an object on its way into a pack, with the delta chosen for
+// it and, once written, where it went.
+type packEntry struct {
+	PackObject
+	objectType object.ObjectType
+	size       int
+	nameHash   uint32
+
+	base  *packEntry
+	delta []byte
+	depth int
+
+	written bool
+	offset  int
+}
+
+// nameHash is git's pack_name_hash: it weighs the last characters of a
+// path most, so that files with the same name or extension sort together.
+func nameHash(path string) uint32 {
+	hash := uint32(0)
+	for _, c := range []byte(path) {
+		if unicode.IsSpace(rune(c)) {
+			continue
+		}
+		hash = (hash >> 2) + uint32(c)<<24
+	}
+	return hash
+}
+
+// windowEntry is a recently tried object kept in the delta window.
+type windowEntry struct {
+	entry *packEntry
+	data  []byte
+	index *deltaIndex
+}
+
+// findDeltas picks a delta base for each entry from the Window entries
+// sorted before it, by type, name hash and then size, largest first, so
+// that newer versions of a file tend to be whole and older ones deltas.
+// Bases always come earlier in that order, so chains cannot loop, and an
+// entry's depth is settled before anything uses it as a base.
+func findDeltas(entries []*packEntry, objects BaseReader, options PackOptions, progressOutput io.Writer) error {
+	if options.Window <= 0 || options.Depth <= 0 {
+		return nil
+	}
+	sorted := make([]*packEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.objectType != b.objectType {
+			return a.objectType < b.objectType
+		}
+		if a.nameHash != b.nameHash {
+			return a.nameHash < b.nameHash
+		}
+		return a.size > b.size
+	})
+
+	meter := progress.New(progressOutput, "Compressing objects", len(sorted))
+	window := []*windowEntry{}
+	for i, entry := range sorted {
+		data, _, err := objects.Read(entry.Name)
+		if err != nil {
+			return err
+		}
+
+		maxSize := entry.size/2 - 20
+		for j := len(window) - 1; j >= 0 && entry.size >= MIN_DELTA_SIZE; j-- {
+			candidate := window[j]
+			if candidate.entry.objectType != entry.objectType || candidate.entry.depth >= options.Depth ||
+				candidate.entry.size < entry.size/32 || maxSize <= 0 {
+				continue
+			}
+			if candidate.index == nil {
+				candidate.index = newDeltaIndex(candidate.data)
+			}
+			if delta := candidate.index.createDelta(data, maxSize); delta != nil {
+				entry.base, entry.delta, entry.depth = candidate.entry, delta, candidate.entry.depth+1
+				maxSize = len(delta) - 1
+			}
+		}
+
+		window = append(window, &windowEntry{entry: entry, data: data})
+		if len(window) > options.Window {
+			window = window[1:]
+		}
+		meter.Update(i+1, 0)
+	}
+	meter.Done()
+	return nil
+}
+
+// writeEntry writes entry to output at offset, after its delta base if
+// that is not written yet, and records where it went in its index entry.
+func writeEntry(output io.Writer, entry *packEntry, objects BaseReader, options PackOptions, offset *int, indexEntries map[*packEntry]*IndexEntry) error {
+	if entry.base != nil && !entry.base.written {
+		if err := writeEntry(output, entry.base, objects, options, offset, indexEntries); err != nil {
+			return err
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	data := entry.delta
+	switch {
+	case entry.base == nil:
+		var err error
+		if data, _, err = objects.Read(entry.Name); err != nil {
+			return err
+		}
+		buffer.Write(encodeObjectHeader(entry.objectType, uint64(len(data))))
+	case options.OffsetDeltas:
+		buffer.Write(encodeObjectHeader(object.OBJ_OFS_DELTA, uint64(len(data))))
+		buffer.Write(encodeOffset(uint64(*offset - entry.base.offset)))
+	default:
+		buffer.Write(encodeObjectHeader(object.OBJ_REF_DELTA, uint64(len(data))))
+		baseName, _ := hex.DecodeString(entry.base.Name)
+		buffer.Write(baseName)
+	}
+	deflater := zlib.NewWriter(buffer)
+	if _, err := deflater.Write(data); err != nil {
+		return err
+	}
+	if err := deflater.Close(); err != nil {
+		return err
+	}
+	if _, err := output.Write(buffer.Bytes()); err != nil {
+		return err
+	}
+
+	name, _ := hex.DecodeString(entry.Name)
+	indexEntries[entry] = &IndexEntry{sha1Hash: name, offset: uint64(*offset), crc: crc32.ChecksumIEEE(buffer.Bytes())}
+	entry.written, entry.offset = true, *offset
+	*offset += buffer.Len()
+	return nil
+}
+
+// writePack writes a version 2 pack of objects, read from store, to
+// writer, and returns its index entries and checksum.
+func writePack(writer io.Writer, objects []PackObject, store BaseReader, options PackOptions, progressOutput io.Writer) ([]IndexEntry, []byte, error) {
+	entries := make([]*packEntry, 0, len(objects))
+	seen := map[string]bool{}
+	for _, packObject := range objects {
+		if seen[packObject.Name] {
+			continue
+		}
+		seen[packObject.Name] = true
+		objectType, size, err := store.Stat(packObject.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, &packEntry{
+			PackObject: packObject,
+			objectType: object.ParseType(objectType),
+			size:       size,
+			nameHash:   nameHash(packObject.Path),
+		})
+	}
+	if err := findDeltas(entries, store, options, progressOutput); err != nil {
+		return nil, nil, err
+	}
+
+	hash := sha1.New()
+	output := bufio.NewWriter(io.MultiWriter(writer, hash))
+	header := append([]byte("PACK"), uint32BigEndian(2)...)
+	header = append(header, uint32BigEndian(uint32(len(entries)))...)
+	if _, err := output.Write(header); err != nil {
+		return nil, nil, err
+	}
+
+	var meter *progress.Meter
+	if len(entries) > 0 {
+		meter = progress.New(progressOutput, "Writing objects", len(entries))
+	}
+	offset := len(header)
+	indexEntries := map[*packEntry]*IndexEntry{}
+	for _, entry := range entries {
+		if !entry.written {
+			if err := writeEntry(output, entry, store, options, &offset, indexEntries); err != nil {
+				return nil, nil, err
+			}
+		}
+		meter.Update(len(indexEntries), int64(offset))
+	}
+	if err := output.Flush(); err != nil {
+		return nil, nil, err
+	}
+	meter.Done()
+
+	checksum := hash.Sum(nil)
+	if _, err := writer.Write(checksum); err != nil {
+		return nil, nil, err
+	}
+
+	written := make([]IndexEntry, 0, len(entries))
+	deltas := 0
+	for _, entry := range entries {
+		written = append(written, *indexEntries[entry])
+		if entry.base != nil {
+			deltas++
+		}
+	}
+	if progressOutput != nil && len(entries) > 0 {
+		fmt.Fprintf(progressOutput, "Total %d (delta %d), reused 0 (delta 0), pack-reused 0\n", len(entries), deltas)
+	}
+	return written, checksum, nil
+}
+
+// WriteObjects writes a version 2 pack of objects, read from store, to
+// writer and returns its checksum. Objects are stored as deltas of each
+// other as options allow. Progress is drawn on progressOutput unless it is
+// nil.
+func WriteObjects(writer io.Writer, objects []PackObject, store BaseReader, options PackOptions, progressOutput io.Writer) ([]byte, error) {
+	_, checksum, err := writePack(writer, objects, store, options, progressOutput)
+	return checksum, err
+}
+
+// WritePackFile writes a pack of objects as <basePath>-<checksum>.pack,
+// with its .idx, and returns the checksum.
+func WritePackFile(basePath string, objects []PackObject, store BaseReader, options PackOptions, progressOutput io.Writer) ([]byte, error) {
+	file, err := os.CreateTemp(filepath.Dir(basePath), "tmp_pack_")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	entries, checksum, err := writePack(file, objects, store, options, progressOutput)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(0444); err != nil {
+		return nil, err
+	}
+	packPath := fmt.Sprintf("%s-%x.pack", basePath, checksum)
+	if err := os.Rename(file.Name(), packPath); err != nil {
+		return nil, err
+	}
+	return checksum, writeIndexAtomic(fmt.Sprintf("%s-%x.idx", basePath, checksum), entries, checksum)
+}
@@ -0,0 +1,111 @@
+// Package pktline encodes and decodes git's pkt-line framing.
+package pktline
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	FLUSH = "0000"
+	// DELIM separates the capability list from the arguments of a protocol
+	// v2 command, and the sections of its response.
+	DELIM = "0001"
+	// RESPONSE_END ends a protocol v2 response in stateless transports.
+	RESPONSE_END = "0002"
+)
+
+var (
+	// ErrProtocol is wrapped by every error caused by a remote that does not
+	// follow the git wire protocol.
+	ErrProtocol = errors.New("protocol error")
+	// ErrBadPktLine is returned when a length prefix is malformed or longer
+	// than the data available.
+	ErrBadPktLine = fmt.Errorf("%w: bad pkt-line", ErrProtocol)
+)
+
+// Read decodes the pkt-line at the start of blob. It returns the number of
+// bytes consumed and the payload without its trailing newline.
+func Read(blob []byte) (int, []byte, error) {
+	n, data, err := ReadRaw(blob)
+	if len(data) > 0 && data[len(data)-1] == '\n' {
+		data = data[:len(data)-1]
+	}
+	return n, data, err
+}
+
+// ReadRaw is like Read but leaves the payload untouched, for binary data
+// such as side-band pack data. A flush, delim or response-end packet yields
+// an empty payload; use Special to tell them apart.
+func ReadRaw(blob []byte) (int, []byte, error) {
+	if len(blob) < 4 {
+		return 0, nil, ErrBadPktLine
+	}
+	pktLength := blob[:4]
+	blob = blob[4:]
+	dst := [2]byte{}
+	_, err := hex.Decode(dst[:], pktLength)
+	if err != nil {
+		return 0, nil, ErrBadPktLine
+	}
+
+	size := uint16(dst[0])<<8 | uint16(dst[1])
+	if size <= 2 {
+		return 4, []byte{}, nil
+	}
+	if size < 4 || len(blob) < int(size)-4 {
+		return 4, nil, ErrBadPktLine
+	}
+
+	return int(size), blob[:size-4], nil
+}
+
+// ReadPacket reads one pkt-line from a stream. A flush, delim or
+// response-end packet is returned as its header with a nil payload; other
+// payloads are returned untouched, as by ReadRaw.
+func ReadPacket(reader io.Reader) (string, []byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", nil, ErrBadPktLine
+		}
+		return "", nil, err
+	}
+	if special := Special(header); special != "" {
+		return special, nil, nil
+	}
+
+	dst := [2]byte{}
+	if _, err := hex.Decode(dst[:], header); err != nil {
+		return "", nil, ErrBadPktLine
+	}
+	size := int(dst[0])<<8 | int(dst[1])
+	if size < 4 {
+		return "", nil, ErrBadPktLine
+	}
+	data := make([]byte, size-4)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return "", nil, ErrBadPktLine
+	}
+	return "", data, nil
+}
+
+// Special returns FLUSH, DELIM or RESPONSE_END when blob starts with that
+// packet, and "" otherwise.
+func Special(blob []byte) string {
+	if len(blob) < 4 {
+		return ""
+	}
+	switch header := string(blob[:4]); header {
+	case FLUSH, DELIM, RESPONSE_END:
+		return header
+	}
+	return ""
+}
+
+// Encode frames line as a pkt-line.
+func Encode(line string) string {
+	return fmt.Sprintf("%04x%s", len(line)+4, line)
+}
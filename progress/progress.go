@@ -0,0 +1,96 @@
+// Package progress draws git style progress meters such as
+// "Receiving objects:  45% (9/20), 1.20 MiB | 2.00 MiB/s".
+package progress
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// REDRAW_INTERVAL bounds how often a meter is redrawn when its percentage
+// has not changed.
+const REDRAW_INTERVAL = time.Second
+
+// Meter counts up to a known total. A nil Meter draws nothing, so callers
+// can pass one around unconditionally.
+type Meter struct {
+	writer io.Writer
+	title  string
+	total  int
+	count  int
+	bytes  int64
+
+	start       time.Time
+	lastDraw    time.Time
+	lastPercent int
+}
+
+// New returns a meter drawn on writer, or nil when writer is nil.
+func New(writer io.Writer, title string, total int) *Meter {
+	if writer == nil {
+		return nil
+	}
+	return &Meter{writer: writer, title: title, total: total, start: time.Now(), lastPercent: -1}
+}
+
+// SetTotal sets the count the meter runs up to, for totals that are only
+// known once work has started.
+func (m *Meter) SetTotal(total int) {
+	if m == nil {
+		return
+	}
+	m.total = total
+}
+
+// Update sets the number of items done and, for transfers, the bytes
+// handled so far. bytes is not shown when it is zero.
+func (m *Meter) Update(count int, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.count, m.bytes = count, bytes
+	percent := m.percent()
+	if percent == m.lastPercent && time.Since(m.lastDraw) < REDRAW_INTERVAL {
+		return
+	}
+	m.lastPercent = percent
+	m.draw("\r")
+}
+
+// Done draws the final state of the meter and ends its line.
+func (m *Meter) Done() {
+	if m == nil {
+		return
+	}
+	m.draw(", done.\n")
+}
+
+func (m *Meter) percent() int {
+	if m.total == 0 {
+		return 100
+	}
+	return m.count * 100 / m.total
+}
+
+func (m *Meter) draw(end string) {
+	m.lastDraw = time.Now()
+	line := fmt.Sprintf("%s: %3d%% (%d/%d)", m.title, m.percent(), m.count, m.total)
+	if m.bytes > 0 {
+		rate := float64(m.bytes) / max(time.Since(m.start).Seconds(), 0.001)
+		line += fmt.Sprintf(", %s | %s/s", formatBytes(float64(m.bytes)), formatBytes(rate))
+	}
+	fmt.Fprint(m.writer, line+end)
+}
+
+func formatBytes(n float64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GiB", n/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MiB", n/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2f KiB", n/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", int64(n))
+}
@@ -0,0 +1,348 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+const DEFAULT_REMOTE = "origin"
+
+// ErrRemoteBranchNotFound is returned when clone --branch names a branch or
+// tag the remote does not have.
+var ErrRemoteBranchNotFound = errors.New("remote branch not found")
+
+// remoteHead picks the branch the remote's HEAD points at, using the
+// symref target when the remote reports one. Older remotes only advertise
+// HEAD's object name, so the first branch with that name is guessed,
+// preferring main and master. It returns "" when HEAD is detached or
+// missing.
+func remoteHead(refs []transport.Ref) (string, string) {
+	head, target := "", ""
+	for _, ref := range refs {
+		if ref.Name == "HEAD" {
+			head, target = ref.Hash, ref.Target
+		}
+	}
+	if branch, ok := strings.CutPrefix(target, "refs/heads/"); ok {
+		return branch, findRef(refs, target)
+	}
+	if head == "" {
+		return "", ""
+	}
+
+	branch := ""
+	for _, ref := range refs {
+		name, ok := strings.CutPrefix(ref.Name, "refs/heads/")
+		if !ok || ref.Hash != head {
+			continue
+		}
+		if name == "main" || name == "master" {
+			return name, head
+		}
+		if branch == "" {
+			branch = name
+		}
+	}
+	return branch, head
+}
+
+func findRef(refs []transport.Ref, name string) string {
+	for _, ref := range refs {
+		if ref.Name == name {
+			return ref.Hash
+		}
+	}
+	return ""
+}
+
+// CloneOptions controls what Clone fetches and checks out.
+type CloneOptions struct {
+	// Branch is checked out instead of the remote's default branch. A tag
+	// is checked out on a detached HEAD.
+	Branch string
+	// A shallow clone fetches only the branch that is checked out.
+	ShallowOptions
+	// Filter makes a partial clone: objects the filter-spec leaves out are
+	// fetched from the remote when they are first needed.
+	Filter string
+	// Progress receives the remote's progress messages and the local
+	// progress meters. Nothing is reported when it is nil.
+	Progress io.Writer
+	// Warnings receives warnings, such as cloning an empty repository.
+	// They are not shown when it is nil.
+	Warnings io.Writer
+	// Local clones a repository on disk by hard-linking its objects and
+	// packs, or copying them where links fail, instead of fetching a pack.
+	// It has no effect on remote URLs, or on a shallow source.
+	Local bool
+}
+
+// selectRefs keeps only HEAD and the branch or tag that will be checked
+// out, for clones that fetch a single branch.
+func selectRefs(refs []transport.Ref, branch string, tag bool) []transport.Ref {
+	selected := "refs/heads/" + branch
+	if tag {
+		selected = "refs/tags/" + branch
+	}
+	kept := []transport.Ref{}
+	for _, ref := range refs {
+		if ref.Name == "HEAD" || ref.Name == selected {
+			kept = append(kept, ref)
+		}
+	}
+	return kept
+}
+
+// localSource returns the repository to link objects from for a local
+// clone of cloneUrl, or nil when it must be fetched from like any remote.
+// Like git, it falls back to fetching from a shallow repository.
+func localSource(cloneUrl string, local bool, warnings io.Writer) (*Repository, error) {
+	path, ok := transport.LocalPath(cloneUrl)
+	if !local || !ok {
+		return nil, nil
+	}
+	source := Find(path)
+	if source == nil {
+		return nil, fmt.Errorf("'%s' %w", path, transport.ErrNotRepository)
+	}
+	shallow, err := source.Shallow()
+	if err != nil {
+		return nil, err
+	}
+	if len(shallow) > 0 {
+		warn(warnings, "source repository is shallow, ignoring --local")
+		return nil, nil
+	}
+	return source, nil
+}
+
+// warn writes message to warnings as a warning, unless warnings is nil.
+func warn(warnings io.Writer, message string) {
+	if warnings != nil {
+		fmt.Fprintf(warnings, "warning: %s\n", message)
+	}
+}
+
+// linkObjects fills the object store with hard links to the loose objects
+// and packs of source, copying the files that cannot be linked, such as
+// those on another file system.
+func (r *Repository) linkObjects(source *Repository) error {
+	sourceDir := filepath.Join(source.GitDir, "objects")
+	targetDir := filepath.Join(r.GitDir, "objects")
+	return filepath.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(targetDir, relative)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if _, err := os.Lstat(target); err == nil {
+			return nil
+		}
+		if os.Link(path, target) == nil {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(sourcePath, targetPath string) error {
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+	info, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+	targetFile, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(targetFile, sourceFile); err != nil {
+		targetFile.Close()
+		return err
+	}
+	return targetFile.Close()
+}
+
+// Clone initialises a repository in dir, fetches every branch and tag of
+// cloneUrl, records them as remote-tracking refs and tags, and checks out
+// the branch chosen by options.
+func Clone(cloneUrl, dir string, options CloneOptions) (*Repository, error) {
+	checkoutBranch := options.Branch
+	source, err := localSource(cloneUrl, options.Local, options.Warnings)
+	if err != nil {
+		return nil, err
+	}
+	if source != nil {
+		if options.shallow() {
+			warn(options.Warnings, "--depth, --shallow-since and --shallow-exclude are ignored in local clones; use file:// instead.")
+			options.ShallowOptions = ShallowOptions{}
+		}
+		if options.Filter != "" {
+			warn(options.Warnings, "--filter is ignored in local clones; use file:// instead.")
+			options.Filter = ""
+		}
+	}
+	if options.Filter != "" {
+		if err := transport.CheckFilter(options.Filter); err != nil {
+			return nil, err
+		}
+	}
+	remote, err := transport.Connect(cloneUrl, transport.ConnectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Close()
+	remote.Progress = options.Progress
+	refs, err := remote.ListRefs([]string{"HEAD", "refs/heads/", "refs/tags/"})
+	if err != nil {
+		return nil, err
+	}
+	branch, head := remoteHead(refs)
+	detachedTag := false
+	if checkoutBranch != "" {
+		branch, head = checkoutBranch, findRef(refs, "refs/heads/"+checkoutBranch)
+		if head == "" {
+			head = findRef(refs, "refs/tags/"+checkoutBranch)
+			detachedTag = head != ""
+		}
+		if head == "" {
+			return nil, fmt.Errorf("%w: %s in upstream %s", ErrRemoteBranchNotFound, checkoutBranch, DEFAULT_REMOTE)
+		}
+	}
+
+	fetchRefspec := Refspec{
+		Force:       true,
+		Source:      "refs/heads/*",
+		Destination: fmt.Sprintf("refs/remotes/%s/*", DEFAULT_REMOTE),
+	}
+	if options.shallow() {
+		refs = selectRefs(refs, branch, detachedTag)
+		if branch != "" && !detachedTag {
+			fetchRefspec.Source = "refs/heads/" + branch
+			fetchRefspec.Destination = fmt.Sprintf("refs/remotes/%s/%s", DEFAULT_REMOTE, branch)
+		}
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	initialBranch := branch
+	if detachedTag {
+		initialBranch = ""
+	}
+	repo, err := Init(dir, initialBranch)
+	if err != nil {
+		return nil, err
+	}
+	config, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	remoteUrl := cloneUrl
+	if path, ok := transport.LocalPath(cloneUrl); ok && path == cloneUrl {
+		// A relative path would not resolve from inside the clone.
+		if remoteUrl, err = filepath.Abs(path); err != nil {
+			return nil, err
+		}
+	}
+	config.Set("remote", DEFAULT_REMOTE, "url", remoteUrl)
+	config.Set("remote", DEFAULT_REMOTE, "fetch", fetchRefspec.String())
+	if options.Filter != "" {
+		config.Set("core", "", "repositoryformatversion", "1")
+		config.Set("extensions", "", "partialclone", DEFAULT_REMOTE)
+		config.Set("remote", DEFAULT_REMOTE, "promisor", "true")
+		config.Set("remote", DEFAULT_REMOTE, "partialclonefilter", options.Filter)
+	}
+	if branch != "" && !detachedTag {
+		config.Set("branch", branch, "remote", DEFAULT_REMOTE)
+		config.Set("branch", branch, "merge", "refs/heads/"+branch)
+	}
+	if err := repo.WriteConfig(config); err != nil {
+		return nil, err
+	}
+	// Reopen so that a partial clone reads through its promisor remote.
+	repo = Open(dir)
+
+	wants := []string{}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if ref.Name == "HEAD" || ref.Hash == "" || seen[ref.Hash] {
+			continue
+		}
+		seen[ref.Hash] = true
+		wants = append(wants, ref.Hash)
+	}
+	if len(wants) == 0 {
+		warn(options.Warnings, "You appear to have cloned an empty repository.")
+		return repo, nil
+	}
+
+	if source != nil {
+		err = repo.linkObjects(source)
+	} else {
+		request := options.ShallowOptions.request()
+		request.Wants = wants
+		request.Filter = options.Filter
+		err = repo.fetchInto(remote, request, options.Progress, options.Filter != "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range refs {
+		localName, ok := fetchRefspec.Map(ref.Name)
+		if !ok && strings.HasPrefix(ref.Name, "refs/tags/") {
+			localName, ok = ref.Name, true
+		}
+		if !ok {
+			continue
+		}
+		if err := repo.UpdateRef(localName, ref.Hash); err != nil {
+			return nil, err
+		}
+	}
+
+	if defaultBranch, _ := remoteHead(refs); defaultBranch != "" && findRef(refs, "refs/heads/"+defaultBranch) != "" {
+		remoteHeadRef := fmt.Sprintf("refs/remotes/%s/HEAD", DEFAULT_REMOTE)
+		if err := repo.WriteSymbolicRef(remoteHeadRef, fmt.Sprintf("refs/remotes/%s/%s", DEFAULT_REMOTE, defaultBranch)); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case head == "":
+		// The remote HEAD is unborn or missing; leave ours unborn too.
+		return repo, nil
+	case detachedTag:
+		head, err = repo.Peel(head, "commit")
+		if err != nil {
+			return nil, err
+		}
+		err = repo.UpdateRef("HEAD", head)
+	case branch == "":
+		err = repo.UpdateRef("HEAD", head)
+	default:
+		err = repo.UpdateRef("refs/heads/"+branch, head)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repo, repo.Checkout(head)
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// CommitTree stores a commit of treeSha1Hash with the given parents, using
+// the same identity as author and committer.
+func (r *Repository) CommitTree(treeSha1Hash string, parents []string, message string, username string, email string) ([]byte, error) {
+	signature := object.Signature(username, email, time.Now())
+	commit := object.Commit{
+		Tree:      treeSha1Hash,
+		Parents:   parents,
+		Author:    signature,
+		Committer: signature,
+		Message:   message + "\n",
+	}
+	return r.Objects.Write("commit", commit.Bytes())
+}
+
+func (r *Repository) ReadCommit(commitHash string) (*object.Commit, error) {
+	data, objectType, err := r.Objects.Read(commitHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := object.CheckType(commitHash, "commit", objectType); err != nil {
+		return nil, err
+	}
+	return object.ParseCommit(data)
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type configEntry struct {
+	section    string
+	subsection string
+	key        string
+	value      string
+}
+
+// Config is the parsed contents of .git/config. Section and key names are
+// case-insensitive, subsection names are not.
+type Config struct {
+	entries []configEntry
+}
+
+func (r *Repository) Config() (*Config, error) {
+	file, err := os.Open(filepath.Join(r.GitDir, "config"))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config := &Config{}
+	var section, subsection string
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			header, ok := strings.CutSuffix(line, "]")
+			if !ok {
+				return nil, fmt.Errorf("bad config line %d in %s", lineNumber, file.Name())
+			}
+			header = header[1:]
+			section, subsection, ok = strings.Cut(header, " ")
+			if ok {
+				subsection = strings.Trim(strings.TrimSpace(subsection), "\"")
+			}
+			section = strings.ToLower(section)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			value = "true"
+		}
+		config.entries = append(config.entries, configEntry{
+			section:    section,
+			subsection: subsection,
+			key:        strings.ToLower(strings.TrimSpace(key)),
+			value:      strings.Trim(strings.TrimSpace(value), "\""),
+		})
+	}
+	return config, scanner.Err()
+}
+
+// Get returns the last value of section.subsection.key.
+func (c *Config) Get(section, subsection, key string) (string, bool) {
+	values := c.GetAll(section, subsection, key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// Bool reports whether section.subsection.key is set to a true value such
+// as "true", "yes", "on" or "1".
+func (c *Config) Bool(section, subsection, key string) bool {
+	value, _ := c.Get(section, subsection, key)
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
+// GetAll returns every value of a multi-valued key in file order.
+func (c *Config) GetAll(section, subsection, key string) []string {
+	values := []string{}
+	for _, entry := range c.entries {
+		if entry.section == strings.ToLower(section) && entry.subsection == subsection && entry.key == strings.ToLower(key) {
+			values = append(values, entry.value)
+		}
+	}
+	return values
+}
+
+// Add appends a value to section.subsection.key, keeping existing values.
+func (c *Config) Add(section, subsection, key, value string) {
+	c.entries = append(c.entries, configEntry{
+		section:    strings.ToLower(section),
+		subsection: subsection,
+		key:        strings.ToLower(key),
+		value:      value,
+	})
+}
+
+// Set replaces every value of section.subsection.key with value.
+func (c *Config) Set(section, subsection, key, value string) {
+	c.Unset(section, subsection, key)
+	c.Add(section, subsection, key, value)
+}
+
+// Unset removes every value of section.subsection.key.
+func (c *Config) Unset(section, subsection, key string) {
+	entries := []configEntry{}
+	for _, entry := range c.entries {
+		if entry.section != strings.ToLower(section) || entry.subsection != subsection || entry.key != strings.ToLower(key) {
+			entries = append(entries, entry)
+		}
+	}
+	c.entries = entries
+}
+
+// Bytes formats the config with one header per section, in the order
+// sections first appear. Comments from the original file are not kept.
+func (c *Config) Bytes() []byte {
+	type header struct{ section, subsection string }
+	headers := []header{}
+	bySection := map[header][]configEntry{}
+	for _, entry := range c.entries {
+		h := header{entry.section, entry.subsection}
+		if _, ok := bySection[h]; !ok {
+			headers = append(headers, h)
+		}
+		bySection[h] = append(bySection[h], entry)
+	}
+
+	var buf strings.Builder
+	for _, h := range headers {
+		if h.subsection == "" {
+			fmt.Fprintf(&buf, "[%s]\n", h.section)
+		} else {
+			fmt.Fprintf(&buf, "[%s %q]\n", h.section, h.subsection)
+		}
+		for _, entry := range bySection[h] {
+			fmt.Fprintf(&buf, "\t%s = %s\n", entry.key, entry.value)
+		}
+	}
+	return []byte(buf.String())
+}
+
+// WriteConfig replaces .git/config with config.
+func (r *Repository) WriteConfig(config *Config) error {
+	return writeFileAtomic(filepath.Join(r.GitDir, "config"), config.Bytes())
+}
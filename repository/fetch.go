@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/storage"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// ErrNotShallow is returned by fetch --unshallow in a complete repository.
+var ErrNotShallow = errors.New("--unshallow on a complete repository does not make sense")
+
+// ErrRefsRejected is returned by Fetch when a ref could not be updated
+// without losing commits.
+var ErrRefsRejected = errors.New("some local refs could not be updated")
+
+// RefStatus is what a fetch or push did to a ref.
+type RefStatus int
+
+const (
+	REF_UP_TO_DATE RefStatus = iota
+	REF_CREATED
+	REF_FAST_FORWARD
+	REF_FORCED
+	REF_DELETED
+	REF_REJECTED
+	// REF_REMOTE_REJECTED is a push the remote refused.
+	REF_REMOTE_REJECTED
+)
+
+// RefUpdate is the change a fetch makes to one local ref.
+type RefUpdate struct {
+	// RemoteName is the ref that was fetched. It is empty for a ref that
+	// was pruned.
+	RemoteName string
+	LocalName  string
+	// Old is empty for a new ref, and New for a deleted one.
+	Old string
+	New string
+	// Force allows an update that is not a fast-forward.
+	Force  bool
+	Status RefStatus
+}
+
+// ShallowOptions limit the history a clone or fetch downloads. The zero
+// value fetches complete history.
+type ShallowOptions struct {
+	// Depth is the number of commits to fetch from the tip of each branch.
+	Depth int
+	// Since fetches only commits newer than a date.
+	Since time.Time
+	// Exclude fetches only commits not reachable from these remote
+	// branches or tags.
+	Exclude []string
+}
+
+func (options ShallowOptions) shallow() bool {
+	return options.Depth > 0 || !options.Since.IsZero() || len(options.Exclude) > 0
+}
+
+func (options ShallowOptions) request() transport.FetchRequest {
+	return transport.FetchRequest{
+		Depth:       options.Depth,
+		DeepenSince: options.Since,
+		DeepenNot:   options.Exclude,
+	}
+}
+
+// FetchOptions controls what Fetch downloads.
+type FetchOptions struct {
+	ShallowOptions
+	// Unshallow fetches the history missing from a shallow repository.
+	Unshallow bool
+	// Force allows every ref to be updated, even when the update is not a
+	// fast-forward.
+	Force bool
+	// Prune deletes remote-tracking refs whose remote ref is gone. It is
+	// also enabled by remote.<name>.prune and fetch.prune.
+	Prune bool
+	// Progress receives the remote's progress messages and the local
+	// progress meters. Nothing is reported when it is nil.
+	Progress io.Writer
+}
+
+// promisorRemote returns the remote a partial clone fetches missing objects
+// from, or "" for a complete repository.
+func (r *Repository) promisorRemote() string {
+	config, err := r.Config()
+	if err != nil {
+		return ""
+	}
+	remoteName, _ := config.Get("extensions", "", "partialclone")
+	return remoteName
+}
+
+// connectOptions returns how to reach remotes as config sets it.
+func connectOptions(config *Config) transport.ConnectOptions {
+	sshCommand, _ := config.Get("core", "", "sshCommand")
+	return transport.ConnectOptions{SSHCommand: sshCommand}
+}
+
+// fetchPromised downloads objects missing from a partial clone. Like git,
+// it asks for them with blob:none, so a missing tree brings its subtrees
+// but not their blobs.
+func (r *Repository) fetchPromised(remoteName string, objectNames []string) error {
+	config, err := r.Config()
+	if err != nil {
+		return err
+	}
+	url, ok := config.Get("remote", remoteName, "url")
+	if !ok {
+		return fmt.Errorf("promisor remote '%s' has no url", remoteName)
+	}
+	remote, err := transport.Connect(url, connectOptions(config))
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	request := transport.FetchRequest{Wants: objectNames, Filter: "blob:none"}
+	return r.fetchInto(remote, request, nil, true)
+}
+
+// fetchInto downloads the pack described by request into the object store
+// and records the shallow boundary the remote reports. Packs from a
+// promisor remote are marked as such.
+func (r *Repository) fetchInto(remote *transport.Remote, request transport.FetchRequest, progress io.Writer, promisor bool) error {
+	shallow, err := r.Shallow()
+	if err != nil {
+		return err
+	}
+	request.Shallow = shallow
+
+	response, err := remote.FetchPack(request)
+	if err != nil {
+		return err
+	}
+	packName, err := storage.StorePackfile(r.GitDir, response.Pack, r.Objects, progress)
+	response.Pack.Close()
+	if err != nil {
+		return err
+	}
+	if promisor {
+		if err := storage.MarkPromisor(r.GitDir, packName); err != nil {
+			return err
+		}
+	}
+	return r.UpdateShallow(response.Shallow, response.Unshallow)
+}
+
+// Fetch downloads the refs selected by the fetch refspecs of remoteName and
+// updates the matching remote-tracking refs. Local commits are offered to
+// the remote so that it only sends what is missing. It returns the refs
+// that changed, or were rejected, along with ErrRefsRejected when any
+// update was not allowed.
+func (r *Repository) Fetch(remoteName string, options FetchOptions) ([]RefUpdate, error) {
+	config, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	url, ok := config.Get("remote", remoteName, "url")
+	if !ok {
+		return nil, fmt.Errorf("'%s' does not appear to be a git repository", remoteName)
+	}
+	refspecs := []Refspec{}
+	for _, value := range config.GetAll("remote", remoteName, "fetch") {
+		refspec, err := ParseRefspec(value)
+		if err != nil {
+			return nil, err
+		}
+		refspecs = append(refspecs, refspec)
+	}
+
+	request := options.ShallowOptions.request()
+	promisor := config.Bool("remote", remoteName, "promisor")
+	request.Filter, _ = config.Get("remote", remoteName, "partialclonefilter")
+	if options.Unshallow {
+		shallow, err := r.Shallow()
+		if err != nil {
+			return nil, err
+		}
+		if len(shallow) == 0 {
+			return nil, ErrNotShallow
+		}
+		request.Depth = transport.INFINITE_DEPTH
+	}
+
+	remote, err := transport.Connect(url, connectOptions(config))
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Close()
+	remote.Progress = options.Progress
+	prefixes := []string{}
+	for _, refspec := range refspecs {
+		prefixes = append(prefixes, strings.TrimSuffix(refspec.Source, "*"))
+	}
+	refs, err := remote.ListRefs(prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := []RefUpdate{}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		for _, refspec := range refspecs {
+			localName, ok := refspec.Map(ref.Name)
+			if !ok || ref.Hash == "" {
+				continue
+			}
+			updates = append(updates, RefUpdate{RemoteName: ref.Name, LocalName: localName, New: ref.Hash, Force: refspec.Force || options.Force})
+			// Refs already present are not asked for again, unless the
+			// history below them is to be deepened.
+			if !seen[ref.Hash] && (!r.Objects.Has(ref.Hash) || options.shallow() || options.Unshallow) {
+				seen[ref.Hash] = true
+				request.Wants = append(request.Wants, ref.Hash)
+			}
+		}
+	}
+
+	if len(request.Wants) > 0 {
+		negotiator, err := r.negotiator()
+		if err != nil {
+			return nil, err
+		}
+		request.Haves = negotiator
+		if err := r.fetchInto(remote, request, options.Progress, promisor); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Prune || config.Bool("remote", remoteName, "prune") || config.Bool("fetch", "", "prune") {
+		pruned, err := r.pruneRefs(refspecs, refs)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, pruned...)
+	}
+	return r.applyRefUpdates(updates)
+}
+
+// pruneRefs returns deletions for the local refs that refspecs map a
+// remote ref to when that remote ref no longer exists.
+func (r *Repository) pruneRefs(refspecs []Refspec, remoteRefs []transport.Ref) ([]RefUpdate, error) {
+	exists := map[string]bool{}
+	for _, ref := range remoteRefs {
+		exists[ref.Name] = true
+	}
+	deletions := []RefUpdate{}
+	for _, refspec := range refspecs {
+		localRefs, err := r.Refs(strings.TrimSuffix(refspec.Destination, "*"))
+		if err != nil {
+			return nil, err
+		}
+		localNames := []string{}
+		for localName := range localRefs {
+			localNames = append(localNames, localName)
+		}
+		sort.Strings(localNames)
+		for _, localName := range localNames {
+			if remoteName, ok := refspec.Reverse(localName); ok && !exists[remoteName] {
+				deletions = append(deletions, RefUpdate{LocalName: localName})
+			}
+		}
+	}
+	return deletions, nil
+}
+
+// applyRefUpdates writes each update whose ref is new, fast-forwards or is
+// forced, and deletes pruned refs. Existing tags only move when forced.
+func (r *Repository) applyRefUpdates(updates []RefUpdate) ([]RefUpdate, error) {
+	rejected := false
+	for i := range updates {
+		update := &updates[i]
+		old, err := r.ReadRef(update.LocalName)
+		if err != nil && !errors.Is(err, ErrRefNotFound) {
+			return nil, err
+		}
+		update.Old = old
+
+		switch {
+		case update.New == "":
+			update.Status = REF_DELETED
+		case old == update.New:
+			update.Status = REF_UP_TO_DATE
+		case old == "":
+			update.Status = REF_CREATED
+		case strings.HasPrefix(update.LocalName, "refs/tags/"):
+			update.Status = REF_REJECTED
+			if update.Force {
+				update.Status = REF_FORCED
+			}
+		default:
+			// Anything that is not a commit cannot be fast-forwarded.
+			fastForward, _ := r.IsAncestor(old, update.New)
+			switch {
+			case fastForward:
+				update.Status = REF_FAST_FORWARD
+			case update.Force:
+				update.Status = REF_FORCED
+			default:
+				update.Status = REF_REJECTED
+			}
+		}
+
+		switch update.Status {
+		case REF_UP_TO_DATE:
+		case REF_REJECTED:
+			rejected = true
+		case REF_DELETED:
+			err = r.DeleteRef(update.LocalName)
+		default:
+			err = r.UpdateRef(update.LocalName, update.New)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rejected {
+		return updates, ErrRefsRejected
+	}
+	return updates, nil
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"container/heap"
+	"errors"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// errStopWalk ends a WalkHistory early without reporting an error.
+var errStopWalk = errors.New("stop walk")
+
+// historyWalk visits the commits reachable from a set of starting points,
+// newest committer date first, each commit once. Shallow commits are
+// treated as roots.
+type historyWalk struct {
+	repo      *Repository
+	isShallow map[string]bool
+	queue     commitQueue
+	seen      map[string]bool
+	pushed    int
+}
+
+type queuedCommit struct {
+	name   string
+	commit *object.Commit
+	time   time.Time
+	// order breaks ties between commits with the same date, oldest
+	// queued first.
+	order int
+}
+
+// commitQueue is a container/heap of commits, newest committer date first.
+type commitQueue []queuedCommit
+
+func (q commitQueue) Len() int { return len(q) }
+
+func (q commitQueue) Less(i, j int) bool {
+	if !q[i].time.Equal(q[j].time) {
+		return q[i].time.After(q[j].time)
+	}
+	return q[i].order < q[j].order
+}
+
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *commitQueue) Push(x any) { *q = append(*q, x.(queuedCommit)) }
+
+func (q *commitQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
+
+func (r *Repository) newHistoryWalk(starts []string) (*historyWalk, error) {
+	isShallow, err := r.shallowSet()
+	if err != nil {
+		return nil, err
+	}
+	walk := &historyWalk{repo: r, isShallow: isShallow, seen: map[string]bool{}}
+	for _, start := range starts {
+		if err := walk.push(start); err != nil {
+			return nil, err
+		}
+	}
+	return walk, nil
+}
+
+func (w *historyWalk) push(commitName string) error {
+	if w.seen[commitName] {
+		return nil
+	}
+	w.seen[commitName] = true
+	commit, err := w.repo.ReadCommit(commitName)
+	if err != nil {
+		return err
+	}
+	heap.Push(&w.queue, queuedCommit{commitName, commit, object.SignatureTime(commit.Committer), w.pushed})
+	w.pushed++
+	return nil
+}
+
+// next returns the newest commit not visited yet and queues its parents.
+// It returns false once every commit has been visited.
+func (w *historyWalk) next() (string, *object.Commit, bool, error) {
+	if len(w.queue) == 0 {
+		return "", nil, false, nil
+	}
+	next := heap.Pop(&w.queue).(queuedCommit)
+
+	if !w.isShallow[next.name] {
+		for _, parent := range next.commit.Parents {
+			if err := w.push(parent); err != nil {
+				return "", nil, false, err
+			}
+		}
+	}
+	return next.name, next.commit, true, nil
+}
+
+// WalkHistory calls fn for each commit reachable from starts, newest
+// committer date first, visiting each commit once. Shallow commits are
+// treated as roots. Returning an error from fn stops the walk.
+func (r *Repository) WalkHistory(starts []string, fn func(commitName string, commit *object.Commit) error) error {
+	walk, err := r.newHistoryWalk(starts)
+	if err != nil {
+		return err
+	}
+	for {
+		commitName, commit, ok, err := walk.next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := fn(commitName, commit); err != nil {
+			return err
+		}
+	}
+}
+
+// IsAncestor reports whether ancestor is reachable from descendant. A
+// commit is its own ancestor.
+func (r *Repository) IsAncestor(ancestor, descendant string) (bool, error) {
+	found := false
+	err := r.WalkHistory([]string{descendant}, func(commitName string, commit *object.Commit) error {
+		if commitName == ancestor {
+			found = true
+			return errStopWalk
+		}
+		return nil
+	})
+	if errors.Is(err, errStopWalk) {
+		err = nil
+	}
+	return found, err
+}
+
+// AllReach reports whether each commit in from has one of targets in its
+// history, itself included. Like git's can_all_from_reach, the search stops
+// at commits older than the oldest target.
+func (r *Repository) AllReach(from, targets []string) (bool, error) {
+	isTarget := map[string]bool{}
+	var oldest time.Time
+	for _, target := range targets {
+		commit, err := r.ReadCommit(target)
+		if err != nil {
+			return false, err
+		}
+		if when := object.SignatureTime(commit.Committer); len(isTarget) == 0 || when.Before(oldest) {
+			oldest = when
+		}
+		isTarget[target] = true
+	}
+	for _, commitName := range from {
+		found := false
+		err := r.WalkHistory([]string{commitName}, func(commitName string, commit *object.Commit) error {
+			if isTarget[commitName] {
+				found = true
+				return errStopWalk
+			}
+			if object.SignatureTime(commit.Committer).Before(oldest) {
+				return errStopWalk
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopWalk) {
+			return false, err
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+// historyNegotiator offers the local history as haves, newest commits
+// first. Once the remote acknowledges a commit, its ancestors are common
+// too and are skipped instead of offered.
+type historyNegotiator struct {
+	walk    *historyWalk
+	common  map[string]bool
+	parents map[string][]string
+}
+
+// negotiator returns a negotiator over the history of every local branch,
+// remote-tracking branch and tag.
+func (r *Repository) negotiator() (*historyNegotiator, error) {
+	refs, err := r.Refs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	starts := []string{}
+	for _, objectName := range refs {
+		// Tags may point at trees or blobs, and refs at objects a partial
+		// clone has not fetched; neither adds anything to offer.
+		if !r.Objects.Has(objectName) {
+			continue
+		}
+		if commitName, err := r.Peel(objectName, "commit"); err == nil {
+			starts = append(starts, commitName)
+		}
+	}
+	walk, err := r.newHistoryWalk(starts)
+	if err != nil {
+		return nil, err
+	}
+	return &historyNegotiator{walk: walk, common: map[string]bool{}, parents: map[string][]string{}}, nil
+}
+
+func (n *historyNegotiator) Next() (string, bool, error) {
+	for {
+		commitName, commit, ok, err := n.walk.next()
+		if err != nil || !ok {
+			return "", false, err
+		}
+		n.parents[commitName] = commit.Parents
+		if !n.common[commitName] {
+			return commitName, true, nil
+		}
+		for _, parent := range commit.Parents {
+			n.common[parent] = true
+		}
+	}
+}
+
+func (n *historyNegotiator) Ack(commitName string) {
+	n.common[commitName] = true
+	for _, parent := range n.parents[commitName] {
+		n.common[parent] = true
+	}
+}
@@ -0,0 +1,94 @@
+package repository_test
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/repository"
+	// The server answers file:// URLs in-process.
+	_ "github.com/codecrafters-io/git-starter-go/server"
+)
+
+// commitFiles writes files into the work tree of repo and commits the
+// whole tree on main.
+func commitFiles(t *testing.T, repo *repository.Repository, files map[string]string, parents ...string) string {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(repo.WorkDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree, err := repo.WriteTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitTree(hex.EncodeToString(tree), parents, "commit", "Test", "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/heads/main", hex.EncodeToString(commit)); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(commit)
+}
+
+func countPacks(t *testing.T, repo *repository.Repository) int {
+	t.Helper()
+	packs, err := filepath.Glob(filepath.Join(repo.GitDir, "objects", "pack", "pack-*.pack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(packs)
+}
+
+func TestPartialCloneFetchesMissingBlobs(t *testing.T) {
+	source, err := repository.Init(filepath.Join(t.TempDir(), "source"), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commitFiles(t, source, map[string]string{"a.txt": "first\n", "d/b.txt": "nested\n"})
+	commitFiles(t, source, map[string]string{"a.txt": "second\n"}, first)
+
+	clone, err := repository.Clone("file://"+source.WorkDir, filepath.Join(t.TempDir(), "clone"), repository.CloneOptions{Filter: "blob:none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The checkout fetches both missing blobs in a single pack on top of
+	// the filtered one.
+	for name, want := range map[string]string{"a.txt": "second\n", "d/b.txt": "nested\n"} {
+		data, err := os.ReadFile(filepath.Join(clone.WorkDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s is %q, want %q", name, data, want)
+		}
+	}
+	if packs := countPacks(t, clone); packs != 2 {
+		t.Errorf("clone has %d packs, want 2", packs)
+	}
+
+	// A blob from older history is fetched when it is first read.
+	oldBlob := hex.EncodeToString(object.Hash("blob", []byte("first\n")))
+	if clone.Objects.Has(oldBlob) {
+		t.Fatalf("blob:none clone already has %s", oldBlob)
+	}
+	data, objectType, err := clone.Objects.Read(oldBlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objectType != "blob" || string(data) != "first\n" {
+		t.Errorf("read %s %q, want blob \"first\\n\"", objectType, data)
+	}
+	if packs := countPacks(t, clone); packs != 3 {
+		t.Errorf("clone has %d packs after the lazy fetch, want 3", packs)
+	}
+}
@@ -0,0 +1,371 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/packfile"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// ErrPushRejected is returned by Push when a ref update was rejected, either
+// by the checks made before pushing or by the remote.
+var ErrPushRejected = errors.New("failed to push some refs")
+
+// ErrNoCurrentBranch is returned by Push without refspecs on a detached
+// HEAD.
+var ErrNoCurrentBranch = errors.New("you are not currently on a branch")
+
+// Lease is what --force-with-lease expects a remote ref to point at.
+type Lease struct {
+	// Ref is the remote ref the lease applies to, or "" for every ref.
+	Ref string
+	// Expect is the object name the remote ref must have, "" to expect the
+	// value of its remote-tracking ref.
+	Expect string
+}
+
+// PushOptions controls how Push updates the remote.
+type PushOptions struct {
+	// Force allows updates that are not fast-forwards.
+	Force bool
+	// ForceWithLease allows updates that are not fast-forwards, but only
+	// while the remote refs still have the values the leases expect.
+	ForceWithLease []Lease
+	// Atomic updates either every ref or none of them.
+	Atomic bool
+	// Progress receives the remote's progress messages and the local
+	// progress meters. Nothing is reported when it is nil.
+	Progress io.Writer
+}
+
+// PushUpdate is the change a push makes to one remote ref.
+type PushUpdate struct {
+	// Source is the local ref or revision pushed, empty for a deletion.
+	Source      string
+	Destination string
+	// Old is empty for a new ref, and New for a deleted one.
+	Old   string
+	New   string
+	Force bool
+	// Status says what happened to the ref, and Reason why it was
+	// rejected.
+	Status RefStatus
+	Reason string
+}
+
+// expandRef returns the full name of the ref a short name refers to, the
+// way git looks it up, and false if there is none.
+func (r *Repository) expandRef(name string) (string, bool, error) {
+	if name == "HEAD" {
+		if target, ok, err := r.ReadSymbolicRef("HEAD"); err != nil || ok {
+			return target, ok, err
+		}
+	}
+	for _, format := range refSearchOrder {
+		fullName := fmt.Sprintf(format, name)
+		_, err := r.ReadRef(fullName)
+		if err == nil {
+			return fullName, true, nil
+		}
+		if !errors.Is(err, ErrRefNotFound) {
+			return "", false, err
+		}
+	}
+	return "", false, nil
+}
+
+// pushUpdates expands refspecs into the updates they ask for, comparing
+// against the refs the remote advertised.
+func (r *Repository) pushUpdates(refspecs []Refspec, remoteRefs map[string]string, force bool) ([]PushUpdate, error) {
+	updates := []PushUpdate{}
+	for _, refspec := range refspecs {
+		if strings.Contains(refspec.Source, "*") {
+			localRefs, err := r.Refs(strings.TrimSuffix(refspec.Source, "*"))
+			if err != nil {
+				return nil, err
+			}
+			for localName, objectName := range localRefs {
+				if destination, ok := refspec.Map(localName); ok {
+					updates = append(updates, PushUpdate{Source: localName, Destination: destination, New: objectName, Force: refspec.Force || force})
+				}
+			}
+			continue
+		}
+
+		update := PushUpdate{Source: refspec.Source, Destination: refspec.Destination, Force: refspec.Force || force}
+		if refspec.Source != "" {
+			sourceRef, isRef, err := r.expandRef(refspec.Source)
+			if err != nil {
+				return nil, err
+			}
+			if isRef {
+				update.Source = sourceRef
+			}
+			update.New, err = r.ResolveRevision(update.Source)
+			if err != nil {
+				return nil, fmt.Errorf("src refspec %s does not match any", refspec.Source)
+			}
+			if update.Destination == "" {
+				if !isRef {
+					return nil, fmt.Errorf("the destination of refspec '%s' is required", refspec.Source)
+				}
+				update.Destination = sourceRef
+			}
+		}
+
+		if !strings.HasPrefix(update.Destination, "refs/") {
+			switch {
+			case remoteRefs["refs/heads/"+update.Destination] != "":
+				update.Destination = "refs/heads/" + update.Destination
+			case remoteRefs["refs/tags/"+update.Destination] != "":
+				update.Destination = "refs/tags/" + update.Destination
+			case strings.HasPrefix(update.Source, "refs/tags/"):
+				update.Destination = "refs/tags/" + update.Destination
+			default:
+				update.Destination = "refs/heads/" + update.Destination
+			}
+		}
+		updates = append(updates, update)
+	}
+	for i := range updates {
+		updates[i].Old = remoteRefs[updates[i].Destination]
+	}
+	return updates, nil
+}
+
+// checkLease reports whether one of leases applies to update and, if so,
+// whether the remote ref still has the value the lease expects.
+func (r *Repository) checkLease(update PushUpdate, leases []Lease, trackingRefs []Refspec) (bool, bool, error) {
+	for _, lease := range leases {
+		if lease.Ref != "" && lease.Ref != update.Destination && "refs/heads/"+lease.Ref != update.Destination && "refs/tags/"+lease.Ref != update.Destination {
+			continue
+		}
+		expect := lease.Expect
+		if expect == "" {
+			for _, refspec := range trackingRefs {
+				if trackingRef, ok := refspec.Map(update.Destination); ok {
+					value, err := r.ReadRef(trackingRef)
+					if err != nil && !errors.Is(err, ErrRefNotFound) {
+						return false, false, err
+					}
+					expect = value
+					break
+				}
+			}
+		} else if resolved, err := r.ResolveRevision(expect); err == nil {
+			expect = resolved
+		}
+		return true, expect == update.Old, nil
+	}
+	return false, false, nil
+}
+
+// checkUpdate decides what a push will do with update before anything is
+// sent, rejecting updates that would lose commits on the remote.
+func (r *Repository) checkUpdate(update *PushUpdate, leases []Lease, trackingRefs []Refspec) error {
+	leased, leaseHolds, err := r.checkLease(*update, leases, trackingRefs)
+	if err != nil {
+		return err
+	}
+	switch {
+	case leased && !leaseHolds:
+		update.Status, update.Reason = REF_REJECTED, "stale info"
+	case update.New == "" && update.Old == "":
+		update.Status, update.Reason = REF_REJECTED, "remote ref does not exist"
+	case update.New == "":
+		update.Status = REF_DELETED
+	case update.Old == update.New:
+		update.Status = REF_UP_TO_DATE
+	case update.Old == "":
+		update.Status = REF_CREATED
+	case update.Force || leased:
+		update.Status = REF_FORCED
+		if fastForward, _ := r.IsAncestor(update.Old, update.New); fastForward {
+			update.Status = REF_FAST_FORWARD
+		}
+	case strings.HasPrefix(update.Destination, "refs/tags/"):
+		update.Status, update.Reason = REF_REJECTED, "already exists"
+	case !r.Objects.Has(update.Old):
+		update.Status, update.Reason = REF_REJECTED, "fetch first"
+	default:
+		// Anything that is not a commit cannot be fast-forwarded.
+		update.Status, update.Reason = REF_REJECTED, "non-fast-forward"
+		if fastForward, _ := r.IsAncestor(update.Old, update.New); fastForward {
+			update.Status, update.Reason = REF_FAST_FORWARD, ""
+		}
+	}
+	return nil
+}
+
+// Push updates the refs of remoteName, which may also be a URL, as
+// refspecs ask, sending the objects the remote lacks. Without refspecs the
+// current branch is pushed to the branch of the same name. Remote-tracking
+// refs are updated for the refs the remote accepted. It returns an update
+// for every ref, along with ErrPushRejected when any was rejected.
+func (r *Repository) Push(remoteName string, refspecs []string, options PushOptions) ([]PushUpdate, error) {
+	config, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	url, ok := config.Get("remote", remoteName, "url")
+	if !ok {
+		// A path that holds no repository is reported as such when it
+		// is connected to.
+		url = remoteName
+	}
+	trackingRefs := []Refspec{}
+	for _, value := range config.GetAll("remote", remoteName, "fetch") {
+		refspec, err := ParseRefspec(value)
+		if err != nil {
+			return nil, err
+		}
+		trackingRefs = append(trackingRefs, refspec)
+	}
+
+	pushRefspecs := []Refspec{}
+	for _, value := range refspecs {
+		refspec, err := ParseRefspec(value)
+		if err != nil {
+			return nil, err
+		}
+		pushRefspecs = append(pushRefspecs, refspec)
+	}
+	if len(pushRefspecs) == 0 {
+		branch, ok, err := r.CurrentBranch()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNoCurrentBranch
+		}
+		pushRefspecs = append(pushRefspecs, Refspec{Source: "refs/heads/" + branch, Destination: "refs/heads/" + branch})
+	}
+
+	remote, err := transport.ConnectPush(url, connectOptions(config))
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Close()
+	remote.Progress = options.Progress
+	refs, err := remote.ListRefs([]string{"refs/"})
+	if err != nil {
+		return nil, err
+	}
+	remoteRefs := map[string]string{}
+	for _, ref := range refs {
+		remoteRefs[ref.Name] = ref.Hash
+	}
+
+	updates, err := r.pushUpdates(pushRefspecs, remoteRefs, options.Force)
+	if err != nil {
+		return nil, err
+	}
+	rejected := false
+	for i := range updates {
+		if err := r.checkUpdate(&updates[i], options.ForceWithLease, trackingRefs); err != nil {
+			return nil, err
+		}
+		rejected = rejected || updates[i].Status == REF_REJECTED
+	}
+	if rejected && options.Atomic {
+		for i := range updates {
+			if updates[i].Status != REF_REJECTED && updates[i].Status != REF_UP_TO_DATE {
+				updates[i].Status, updates[i].Reason = REF_REJECTED, "atomic push failed"
+			}
+		}
+		return updates, ErrPushRejected
+	}
+
+	request := transport.PushRequest{Atomic: options.Atomic}
+	sent := []*PushUpdate{}
+	include := []string{}
+	for i := range updates {
+		update := &updates[i]
+		if update.Status == REF_REJECTED || update.Status == REF_UP_TO_DATE {
+			continue
+		}
+		command := transport.PushCommand{Name: update.Destination, Old: update.Old, New: update.New}
+		if command.Old == "" {
+			command.Old = transport.ZERO_ID
+		}
+		if command.New == "" {
+			command.New = transport.ZERO_ID
+		} else {
+			include = append(include, update.New)
+		}
+		request.Commands = append(request.Commands, command)
+		sent = append(sent, update)
+	}
+	if len(sent) == 0 {
+		if rejected {
+			return updates, ErrPushRejected
+		}
+		return updates, nil
+	}
+
+	// No pack is sent when every command is a deletion.
+	if len(include) > 0 {
+		exclude := []string{}
+		for _, objectName := range remoteRefs {
+			exclude = append(exclude, objectName)
+		}
+		objects, err := r.ReachableObjects(include, exclude)
+		if err != nil {
+			return nil, err
+		}
+		packReader, packWriter := io.Pipe()
+		defer packReader.Close()
+		go func() {
+			packOptions := packfile.DefaultPackOptions()
+			packOptions.OffsetDeltas = remote.Capabilities.Has("ofs-delta")
+			_, err := packfile.WriteObjects(packWriter, objects, r.Objects, packOptions, options.Progress)
+			packWriter.CloseWithError(err)
+		}()
+		request.Pack = packReader
+	}
+
+	report, err := remote.Push(request)
+	if err != nil {
+		return nil, err
+	}
+	for _, update := range sent {
+		reason, refused := report.Rejected[update.Destination]
+		if report.Unpack != "ok" && !refused {
+			reason, refused = "unpacker error", true
+		}
+		if refused {
+			update.Status, update.Reason = REF_REMOTE_REJECTED, reason
+			rejected = true
+			continue
+		}
+		if err := r.updateTrackingRef(trackingRefs, *update); err != nil {
+			return nil, err
+		}
+	}
+	if report.Unpack != "ok" {
+		return updates, fmt.Errorf("unpack failed: %s", report.Unpack)
+	}
+	if rejected {
+		return updates, ErrPushRejected
+	}
+	return updates, nil
+}
+
+// updateTrackingRef records a pushed update in the remote-tracking ref the
+// fetch refspecs map its destination to, if any.
+func (r *Repository) updateTrackingRef(trackingRefs []Refspec, update PushUpdate) error {
+	for _, refspec := range trackingRefs {
+		trackingRef, ok := refspec.Map(update.Destination)
+		if !ok {
+			continue
+		}
+		if update.New == "" {
+			return r.DeleteRef(trackingRef)
+		}
+		return r.UpdateRef(trackingRef, update.New)
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+package repository
+
+import (
+	"container/heap"
+	"encoding/hex"
+	"errors"
+	"path"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/packfile"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// ReachableObjects lists the objects reachable from include but not from
+// exclude: annotated tags, commits, and the trees and blobs of those
+// commits. Like git's --objects-edge, trees and blobs are left out when
+// they appear in an excluded tip or in an excluded parent of an included
+// commit; older excluded history is not searched. Excluded names that are
+// not present locally are ignored. Trees and blobs come with the path they
+// were first found at, to group them for delta compression.
+func (r *Repository) ReachableObjects(include, exclude []string) ([]packfile.PackObject, error) {
+	return r.ShallowReachableObjects(include, exclude, nil, nil, transport.Filter{})
+}
+
+// IsConnected reports whether every object reachable from tips is present,
+// walking down to what is reachable from haves, which is taken to be
+// complete. Like git's connectivity check, receive-pack uses it with the
+// existing refs as haves before it lets new objects be referenced.
+func (r *Repository) IsConnected(tips, haves []string) (bool, error) {
+	objects, err := r.ReachableObjects(tips, haves)
+	if errors.Is(err, object.ErrObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, packObject := range objects {
+		if !r.Objects.Has(packObject.Name) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Unreachable returns the objects in objectNames that are not reachable
+// from tips. Commits are looked for in the history of the tips; the trees
+// of the commits walked are only read while trees or blobs are still
+// missing. The walk stops once every object has been found.
+func (r *Repository) Unreachable(objectNames, tips []string) ([]string, error) {
+	missing := map[string]bool{}
+	missingOthers := 0
+	for _, objectName := range objectNames {
+		if missing[objectName] {
+			continue
+		}
+		objectType, _, err := r.Objects.Stat(objectName)
+		if err != nil {
+			return nil, err
+		}
+		missing[objectName] = true
+		if objectType != "commit" {
+			missingOthers++
+		}
+	}
+	found := func(objectName string, _ string) {
+		if missing[objectName] {
+			delete(missing, objectName)
+			missingOthers--
+		}
+	}
+
+	// Peel the tips, finding the tags on the way and the trees and
+	// blobs they name.
+	starts := []string{}
+	visited := map[string]bool{}
+	for _, objectName := range tips {
+		for len(missing) > 0 {
+			data, objectType, err := r.Objects.Read(objectName)
+			if err != nil {
+				return nil, err
+			}
+			if objectType == "commit" {
+				starts = append(starts, objectName)
+				break
+			}
+			if objectType == "tree" {
+				if err := r.walkTree(objectName, "", visited, found); err != nil {
+					return nil, err
+				}
+				break
+			}
+			found(objectName, "")
+			if objectType != "tag" {
+				break
+			}
+			tag, err := object.ParseTag(data)
+			if err != nil {
+				return nil, err
+			}
+			objectName = tag.Object
+		}
+	}
+
+	err := r.WalkHistory(starts, func(commitName string, commit *object.Commit) error {
+		if missing[commitName] {
+			delete(missing, commitName)
+		}
+		if missingOthers > 0 {
+			if err := r.walkTree(commit.Tree, "", visited, found); err != nil {
+				return err
+			}
+		}
+		if len(missing) == 0 {
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopWalk) {
+		return nil, err
+	}
+	unreachable := []string{}
+	for _, objectName := range objectNames {
+		if missing[objectName] {
+			unreachable = append(unreachable, objectName)
+		}
+	}
+	return unreachable, nil
+}
+
+// ShallowReachableObjects is ReachableObjects for a shallow client. The
+// client has no parents for the commits in clientShallow, so the walk from
+// exclude stops there, and the walk from include stops at the commits in
+// boundary, whose parents are not to be sent. Trees and blobs that filter
+// excludes are left out, unless they are in include themselves.
+func (r *Repository) ShallowReachableObjects(include, exclude, clientShallow, boundary []string, filter transport.Filter) ([]packfile.PackObject, error) {
+	isShallow, err := r.shallowSet()
+	if err != nil {
+		return nil, err
+	}
+	isBoundary := map[string]bool{}
+	for _, commitName := range boundary {
+		isBoundary[commitName] = true
+	}
+
+	excludeCommits := []string{}
+	for _, objectName := range exclude {
+		if !r.Objects.Has(objectName) {
+			continue
+		}
+		if commitName, err := r.Peel(objectName, "commit"); err == nil {
+			excludeCommits = append(excludeCommits, commitName)
+		}
+	}
+
+	objects := []packfile.PackObject{}
+	seen := map[string]bool{}
+	for _, objectName := range exclude {
+		seen[objectName] = true
+	}
+	add := func(objectName string, path string) {
+		if !seen[objectName] {
+			seen[objectName] = true
+			objects = append(objects, packfile.PackObject{Name: objectName, Path: path})
+		}
+	}
+
+	// Peel the included tips, keeping the tags on the way, and collect
+	// the commits not reachable from exclude.
+	tipTrees := []string{}
+	stack := []string{}
+	for _, objectName := range include {
+		for !seen[objectName] {
+			data, objectType, err := r.Objects.Read(objectName)
+			if err != nil {
+				return nil, err
+			}
+			if objectType == "commit" {
+				stack = append(stack, objectName)
+				break
+			}
+			add(objectName, "")
+			if objectType == "tree" {
+				tipTrees = append(tipTrees, objectName)
+			}
+			if objectType != "tag" {
+				break
+			}
+			tag, err := object.ParseTag(data)
+			if err != nil {
+				return nil, err
+			}
+			objectName = tag.Object
+		}
+	}
+	isClientShallow := map[string]bool{}
+	for _, commitName := range clientShallow {
+		isClientShallow[commitName] = true
+	}
+	commits, edges, err := r.limitCommits(stack, excludeCommits, func(commitName string, interesting bool) bool {
+		if isShallow[commitName] {
+			return false
+		}
+		if interesting {
+			return !isBoundary[commitName]
+		}
+		return !isClientShallow[commitName]
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, commitName := range commits {
+		add(commitName, "")
+	}
+	edges = append(edges, excludeCommits...)
+
+	// Mark what the edge commits already have, then add the rest of the
+	// trees and blobs of the included commits.
+	marked := map[string]bool{}
+	for _, commitName := range edges {
+		commit, err := r.ReadCommit(commitName)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.walkTree(commit.Tree, "", marked, func(string, string) {}); err != nil {
+			return nil, err
+		}
+	}
+	trees := []string{}
+	for _, commitName := range commits {
+		commit, err := r.ReadCommit(commitName)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, commit.Tree)
+	}
+	if filter == (transport.Filter{}) {
+		for _, tree := range append(tipTrees, trees...) {
+			if err := r.walkTree(tree, "", marked, add); err != nil {
+				return nil, err
+			}
+		}
+		return objects, nil
+	}
+
+	// Trees asked for by name are sent whatever the filter, and are roots
+	// like the trees of commits, which tree:0 leaves out.
+	depths := map[string]uint64{}
+	for _, tree := range tipTrees {
+		if err := r.walkFilteredTree(tree, "", 0, filter, marked, depths, add); err != nil {
+			return nil, err
+		}
+	}
+	for _, tree := range trees {
+		if filter.LimitDepth && filter.TreeDepth == 0 {
+			break
+		}
+		if err := r.walkFilteredTree(tree, "", 0, filter, marked, depths, add); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// walkFilteredTree calls fn for a tree at treePath, depth levels below a
+// root tree, and the trees and blobs below it that filter allows and
+// visited does not hold, with their paths. depths records how close to a
+// root each tree has been walked from: a tree found nearer a root than
+// before is walked again, as more of it may now be allowed.
+func (r *Repository) walkFilteredTree(treeHash string, treePath string, depth uint64, filter transport.Filter, visited map[string]bool, depths map[string]uint64, fn func(objectName string, path string)) error {
+	if walked, ok := depths[treeHash]; visited[treeHash] || ok && (walked <= depth || !filter.LimitDepth) {
+		return nil
+	}
+	depths[treeHash] = depth
+	fn(treeHash, treePath)
+	if filter.LimitDepth && depth+1 >= filter.TreeDepth {
+		return nil
+	}
+	treeEntries, err := r.ReadTree(treeHash)
+	if err != nil {
+		return err
+	}
+	for _, entry := range treeEntries {
+		objectName := hex.EncodeToString(entry.Hash)
+		switch {
+		case entry.Mode == object.DIR:
+			if err := r.walkFilteredTree(objectName, path.Join(treePath, entry.Name), depth+1, filter, visited, depths, fn); err != nil {
+				return err
+			}
+		case entry.Mode == object.GITLINK || visited[objectName]:
+		case filter.LimitBlobs && filter.BlobLimit == 0:
+		case filter.LimitBlobs:
+			_, size, err := r.Objects.Stat(objectName)
+			if err != nil {
+				return err
+			}
+			if uint64(size) < filter.BlobLimit {
+				fn(objectName, path.Join(treePath, entry.Name))
+			}
+		default:
+			fn(objectName, path.Join(treePath, entry.Name))
+		}
+	}
+	return nil
+}
+
+// limitCommits walks the commits reachable from include and exclude
+// together, newest committer date first, as rev-list does. Everything
+// reachable from exclude is uninteresting, and the walk stops once only
+// uninteresting commits are left to visit, rather than going through all
+// of the excluded history. followParents tells whether the walk goes on
+// to the parents of an interesting or uninteresting commit. It returns
+// the interesting commits in the order they were visited, and the
+// uninteresting commits that are parents of interesting ones.
+func (r *Repository) limitCommits(include, exclude []string, followParents func(commitName string, interesting bool) bool) ([]string, []string, error) {
+	queue := commitQueue{}
+	queued := map[string]bool{}
+	inQueue := map[string]bool{}
+	uninteresting := map[string]bool{}
+	parents := map[string][]string{}
+	interestingQueued := 0
+
+	push := func(commitName string) error {
+		if queued[commitName] {
+			return nil
+		}
+		commit, err := r.ReadCommit(commitName)
+		if err != nil {
+			return err
+		}
+		queued[commitName], inQueue[commitName] = true, true
+		if !uninteresting[commitName] {
+			interestingQueued++
+		}
+		heap.Push(&queue, queuedCommit{commitName, commit, object.SignatureTime(commit.Committer), len(queued)})
+		return nil
+	}
+	// markUninteresting marks a commit and, as far as the walk has seen
+	// them, its ancestors uninteresting.
+	markUninteresting := func(commitName string) {
+		stack := []string{commitName}
+		for len(stack) > 0 {
+			commitName := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if uninteresting[commitName] {
+				continue
+			}
+			uninteresting[commitName] = true
+			if inQueue[commitName] {
+				interestingQueued--
+			}
+			stack = append(stack, parents[commitName]...)
+		}
+	}
+
+	for _, commitName := range exclude {
+		markUninteresting(commitName)
+		if err := push(commitName); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, commitName := range include {
+		if err := push(commitName); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	visited := []string{}
+	for interestingQueued > 0 {
+		next := heap.Pop(&queue).(queuedCommit)
+		inQueue[next.name] = false
+		interesting := !uninteresting[next.name]
+		if interesting {
+			interestingQueued--
+			visited = append(visited, next.name)
+		}
+		if !followParents(next.name, interesting) {
+			continue
+		}
+		parents[next.name] = next.commit.Parents
+		for _, parent := range next.commit.Parents {
+			if !interesting {
+				markUninteresting(parent)
+			}
+			if err := push(parent); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	commits, edges := []string{}, []string{}
+	isEdge := map[string]bool{}
+	for _, commitName := range visited {
+		if uninteresting[commitName] {
+			continue
+		}
+		commits = append(commits, commitName)
+		for _, parent := range parents[commitName] {
+			if uninteresting[parent] && !isEdge[parent] {
+				isEdge[parent] = true
+				edges = append(edges, parent)
+			}
+		}
+	}
+	return commits, edges, nil
+}
+
+// walkTree calls fn for a tree at treePath and every tree and blob below
+// it that is not in visited, with its path, adding them to visited. Trees
+// in visited are not descended into. Submodule commits are skipped.
+func (r *Repository) walkTree(treeHash string, treePath string, visited map[string]bool, fn func(objectName string, path string)) error {
+	if visited[treeHash] {
+		return nil
+	}
+	visited[treeHash] = true
+	fn(treeHash, treePath)
+	treeEntries, err := r.ReadTree(treeHash)
+	if err != nil {
+		return err
+	}
+	for _, entry := range treeEntries {
+		objectName := hex.EncodeToString(entry.Hash)
+		switch {
+		case entry.Mode == object.DIR:
+			if err := r.walkTree(objectName, path.Join(treePath, entry.Name), visited, fn); err != nil {
+				return err
+			}
+		case entry.Mode != object.GITLINK && !visited[objectName]:
+			visited[objectName] = true
+			fn(objectName, path.Join(treePath, entry.Name))
+		}
+	}
+	return nil
+}
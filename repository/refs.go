@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+const MAX_SYMREF_DEPTH = 5
+
+// ErrRefNotFound is returned when neither a loose ref file nor a
+// packed-refs entry exists for a ref.
+var ErrRefNotFound = errors.New("ref not found")
+
+// ReadSymbolicRef returns the ref that name points at, and false if name is
+// not a symbolic ref.
+func (r *Repository) ReadSymbolicRef(name string) (string, bool, error) {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, filepath.FromSlash(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: ")
+	return target, ok, nil
+}
+
+// ReadRef returns the object name a ref points at, following symbolic refs.
+// A directory of refs, such as refs/remotes/origin, is not a ref.
+func (r *Repository) ReadRef(name string) (string, error) {
+	for depth := 0; depth < MAX_SYMREF_DEPTH; depth++ {
+		path := filepath.Join(r.GitDir, filepath.FromSlash(name))
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			if info, statErr := os.Stat(path); statErr == nil && info.IsDir() {
+				break
+			}
+			return "", err
+		}
+
+		value := strings.TrimSpace(string(data))
+		if target, ok := strings.CutPrefix(value, "ref: "); ok {
+			name = target
+			continue
+		}
+		if !object.IsName(value) {
+			return "", fmt.Errorf("bad ref %s: %q", name, value)
+		}
+		return value, nil
+	}
+
+	packedRefs, err := r.PackedRefs()
+	if err != nil {
+		return "", err
+	}
+	if value, ok := packedRefs[name]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrRefNotFound, name)
+}
+
+// PackedRefs reads the packed-refs file, which is missing in repositories
+// that never packed their refs.
+func (r *Repository) PackedRefs() (map[string]string, error) {
+	refs := map[string]string{}
+	file, err := os.Open(filepath.Join(r.GitDir, "packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		value, name, ok := strings.Cut(line, " ")
+		if ok && object.IsName(value) {
+			refs[name] = value
+		}
+	}
+	return refs, scanner.Err()
+}
+
+// Refs returns the refs whose names start with prefix, such as
+// "refs/remotes/origin/", from both loose ref files and packed-refs.
+// Symbolic refs are left out.
+func (r *Repository) Refs(prefix string) (map[string]string, error) {
+	refs := map[string]string{}
+	packedRefs, err := r.PackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range packedRefs {
+		if strings.HasPrefix(name, prefix) {
+			refs[name] = value
+		}
+	}
+
+	root := filepath.Join(r.GitDir, "refs")
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasSuffix(path, ".lock") {
+			return err
+		}
+		relative, err := filepath.Rel(r.GitDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relative)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if value := strings.TrimSpace(string(data)); object.IsName(value) {
+			refs[name] = value
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return refs, nil
+	}
+	return refs, err
+}
+
+// writeFileAtomic writes data to path.lock and renames it over path, so
+// readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	lockPath := path + ".lock"
+	file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("unable to create '%s': file exists", lockPath)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(lockPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(lockPath)
+		return err
+	}
+	return os.Rename(lockPath, path)
+}
+
+// CheckRefFormat reports whether name is a valid ref name under git's
+// check-ref-format rules: no component may start with "." or end with
+// ".lock", and the name may not contain "..", "@{", "//", control
+// characters, spaces or any of ~^:?*[\, start or end with "/", end with
+// ".", or be "@".
+func CheckRefFormat(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") {
+		return false
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.ContainsAny(name, " ~^:?*[\\") {
+		return false
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f {
+			return false
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
+
+// RefLock holds the lock file of a ref, so that nothing else writes the
+// ref between reading it and writing it. It is released by Update, Delete
+// or Unlock.
+type RefLock struct {
+	repo *Repository
+	name string
+	file *os.File
+}
+
+// LockRef takes the lock on name by creating name.lock, failing if another
+// writer holds it.
+func (r *Repository) LockRef(name string) (*RefLock, error) {
+	path := filepath.Join(r.GitDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path+".lock", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("unable to create '%s.lock': file exists", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &RefLock{repo: r, name: name, file: file}, nil
+}
+
+func (l *RefLock) path() string {
+	return filepath.Join(l.repo.GitDir, filepath.FromSlash(l.name))
+}
+
+// Update points the locked ref at objectName and releases the lock.
+func (l *RefLock) Update(objectName string) error {
+	if !object.IsName(objectName) {
+		l.Unlock()
+		return object.InvalidName(objectName)
+	}
+	if _, err := l.file.WriteString(objectName + "\n"); err != nil {
+		l.Unlock()
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		os.Remove(l.path() + ".lock")
+		return err
+	}
+	if err := os.Rename(l.path()+".lock", l.path()); err != nil {
+		os.Remove(l.path() + ".lock")
+		return err
+	}
+	return nil
+}
+
+// Delete removes the locked ref and releases the lock.
+func (l *RefLock) Delete() error {
+	defer l.Unlock()
+	return l.repo.DeleteRef(l.name)
+}
+
+// Unlock releases the lock without changing the ref.
+func (l *RefLock) Unlock() {
+	l.file.Close()
+	os.Remove(l.path() + ".lock")
+}
+
+// UpdateRef points name at objectName. A symbolic ref is overwritten, not
+// followed.
+func (r *Repository) UpdateRef(name, objectName string) error {
+	if !object.IsName(objectName) {
+		return object.InvalidName(objectName)
+	}
+	return writeFileAtomic(filepath.Join(r.GitDir, filepath.FromSlash(name)), []byte(objectName+"\n"))
+}
+
+// DeleteRef removes a ref, both its loose file and its packed-refs entry.
+func (r *Repository) DeleteRef(name string) error {
+	err := os.Remove(filepath.Join(r.GitDir, filepath.FromSlash(name)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	packedRefs, err := r.PackedRefs()
+	if err != nil {
+		return err
+	}
+	if _, ok := packedRefs[name]; !ok {
+		return nil
+	}
+	delete(packedRefs, name)
+	names := []string{}
+	for refName := range packedRefs {
+		names = append(names, refName)
+	}
+	sort.Strings(names)
+	data := ""
+	for _, refName := range names {
+		data += fmt.Sprintf("%s %s\n", packedRefs[refName], refName)
+	}
+	return writeFileAtomic(filepath.Join(r.GitDir, "packed-refs"), []byte(data))
+}
+
+// WriteSymbolicRef makes name a symbolic ref to target.
+func (r *Repository) WriteSymbolicRef(name, target string) error {
+	return writeFileAtomic(filepath.Join(r.GitDir, filepath.FromSlash(name)), []byte("ref: "+target+"\n"))
+}
+
+// CurrentBranch returns the branch HEAD points at, without "refs/heads/",
+// and false when HEAD is detached.
+func (r *Repository) CurrentBranch() (string, bool, error) {
+	target, ok, err := r.ReadSymbolicRef("HEAD")
+	if err != nil || !ok {
+		return "", false, err
+	}
+	branch, ok := strings.CutPrefix(target, "refs/heads/")
+	return branch, ok, nil
+}
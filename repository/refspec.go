@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Refspec maps remote refs to local refs, as in
+// "+refs/heads/*:refs/remotes/origin/*".
+type Refspec struct {
+	Force       bool
+	Source      string
+	Destination string
+}
+
+func ParseRefspec(spec string) (Refspec, error) {
+	refspec := Refspec{}
+	spec, refspec.Force = strings.CutPrefix(spec, "+")
+	refspec.Source, refspec.Destination, _ = strings.Cut(spec, ":")
+	if strings.Count(refspec.Source, "*") != strings.Count(refspec.Destination, "*") || strings.Count(refspec.Source, "*") > 1 {
+		return refspec, fmt.Errorf("invalid refspec '%s'", spec)
+	}
+	return refspec, nil
+}
+
+func (refspec Refspec) String() string {
+	spec := refspec.Source + ":" + refspec.Destination
+	if refspec.Force {
+		return "+" + spec
+	}
+	return spec
+}
+
+func mapPattern(from, to, ref string) (string, bool) {
+	prefix, suffix, wildcard := strings.Cut(from, "*")
+	if !wildcard {
+		return to, ref == from
+	}
+	if !strings.HasPrefix(ref, prefix) || !strings.HasSuffix(ref, suffix) || len(ref) < len(prefix)+len(suffix) {
+		return "", false
+	}
+	match := ref[len(prefix) : len(ref)-len(suffix)]
+	return strings.Replace(to, "*", match, 1), true
+}
+
+// Map returns the local ref a remote ref is stored as, and false if the
+// refspec does not match it.
+func (refspec Refspec) Map(ref string) (string, bool) {
+	return mapPattern(refspec.Source, refspec.Destination, ref)
+}
+
+// Reverse returns the remote ref a local ref was fetched from.
+func (refspec Refspec) Reverse(ref string) (string, bool) {
+	return mapPattern(refspec.Destination, refspec.Source, ref)
+}
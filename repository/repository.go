@@ -0,0 +1,128 @@
+// Package repository implements repository level operations on top of the
+// object store: init, hashing files, writing trees and commits, checkout and
+// clone.
+package repository
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+const (
+	GIT_DIR = ".git"
+	// DEFAULT_BRANCH is the branch HEAD points at in a new repository.
+	DEFAULT_BRANCH = "main"
+)
+
+type Repository struct {
+	// WorkDir is empty for a bare repository.
+	WorkDir string
+	GitDir  string
+	Objects storage.ObjectStore
+}
+
+// Open returns the repository whose work tree is workDir. It does not check
+// that the git directory exists. In a partial clone, objects missing locally
+// are fetched from the promisor remote when they are read.
+func Open(workDir string) *Repository {
+	return open(workDir, filepath.Join(workDir, GIT_DIR))
+}
+
+// OpenBare returns the repository stored directly in gitDir, which has no
+// work tree.
+func OpenBare(gitDir string) *Repository {
+	return open("", gitDir)
+}
+
+// Find opens the repository at dir, as git does for the paths it is given
+// to serve: a work tree with a .git directory, a bare repository, or a
+// bare repository named dir with ".git" added. It returns nil when there is
+// none.
+func Find(dir string) *Repository {
+	isGitDir := func(dir string) bool {
+		_, headErr := os.Stat(filepath.Join(dir, "HEAD"))
+		info, objectsErr := os.Stat(filepath.Join(dir, "objects"))
+		return headErr == nil && objectsErr == nil && info.IsDir()
+	}
+	switch {
+	case isGitDir(filepath.Join(dir, GIT_DIR)):
+		return Open(dir)
+	case isGitDir(dir):
+		return OpenBare(dir)
+	case isGitDir(dir + ".git"):
+		return OpenBare(dir + ".git")
+	}
+	return nil
+}
+
+func open(workDir string, gitDir string) *Repository {
+	repo := &Repository{
+		WorkDir: workDir,
+		GitDir:  gitDir,
+		Objects: storage.NewRepositoryObjectStore(gitDir),
+	}
+	if remoteName := repo.promisorRemote(); remoteName != "" {
+		repo.Objects = storage.NewPromisorObjectStore(repo.Objects, func(objectNames []string) error {
+			return repo.fetchPromised(remoteName, objectNames)
+		})
+	}
+	return repo
+}
+
+// Init creates an empty git directory inside workDir whose HEAD points at
+// initialBranch, or DEFAULT_BRANCH when it is empty.
+func Init(workDir string, initialBranch string) (*Repository, error) {
+	if initialBranch == "" {
+		initialBranch = DEFAULT_BRANCH
+	}
+
+	repo := Open(workDir)
+	for _, dir := range []string{repo.GitDir, filepath.Join(repo.GitDir, "objects"), filepath.Join(repo.GitDir, "refs")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating directory: %v", err)
+		}
+	}
+
+	if err := repo.WriteSymbolicRef("HEAD", "refs/heads/"+initialBranch); err != nil {
+		return nil, err
+	}
+
+	config, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	config.Set("core", "", "repositoryformatversion", "0")
+	config.Set("core", "", "filemode", "true")
+	config.Set("core", "", "bare", "false")
+	return repo, repo.WriteConfig(config)
+}
+
+// HashFile stores the contents of filename as a blob.
+func (r *Repository) HashFile(filename string) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("not able to read file %s: %v", filename, err)
+	}
+	defer file.Close()
+
+	return r.HashObject(file, "blob", true)
+}
+
+// HashObject names the contents of reader as an object of objectType, and
+// stores it when write is set.
+func (r *Repository) HashObject(reader io.Reader, objectType string, write bool) ([]byte, error) {
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("not able to read object contents: %v", err)
+	}
+
+	if !write {
+		return object.Hash(objectType, contents), nil
+	}
+	return r.Objects.Write(objectType, contents)
+}
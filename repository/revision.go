@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+const MIN_ABBREV_LENGTH = 4
+
+var (
+	// ErrUnknownRevision means a revision names no ref, object or path.
+	ErrUnknownRevision = errors.New("unknown revision or path not in the working tree")
+	// ErrAmbiguousRevision means an abbreviated name matches more than one
+	// object.
+	ErrAmbiguousRevision = errors.New("short object ID is ambiguous")
+	// ErrNoUpstream means @{upstream} was used on a branch without one.
+	ErrNoUpstream = errors.New("no upstream configured for branch")
+)
+
+// RevisionError is returned by ResolveRevision and records which revision
+// could not be resolved.
+type RevisionError struct {
+	Revision string
+	Err      error
+}
+
+func (e *RevisionError) Error() string {
+	return fmt.Sprintf("ambiguous argument '%s': %v", e.Revision, e.Err)
+}
+
+func (e *RevisionError) Unwrap() error {
+	return e.Err
+}
+
+// refSearchOrder is the list of places a short ref name is looked up, in
+// the order git uses.
+var refSearchOrder = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+// ResolveRevision turns a revision expression into a full object name. It
+// understands full and abbreviated object names, ref names, HEAD and @,
+// <rev>^N, <rev>~N, <rev>^{type}, <rev>^{}, <rev>:<path> and
+// <branch>@{upstream}.
+func (r *Repository) ResolveRevision(revision string) (string, error) {
+	objectName, err := r.resolveRevision(revision)
+	if err != nil {
+		var revisionError *RevisionError
+		if errors.As(err, &revisionError) {
+			return "", err
+		}
+		return "", &RevisionError{Revision: revision, Err: err}
+	}
+	return objectName, nil
+}
+
+func (r *Repository) resolveRevision(revision string) (string, error) {
+	if treeish, path, ok := strings.Cut(revision, ":"); ok {
+		if treeish == "" {
+			return "", fmt.Errorf("%w: index paths are not supported", ErrUnknownRevision)
+		}
+		objectName, err := r.resolveRevision(treeish)
+		if err != nil {
+			return "", err
+		}
+		tree, err := r.Peel(objectName, "tree")
+		if err != nil {
+			return "", err
+		}
+		return r.lookupPath(tree, path)
+	}
+
+	base, operators := splitRevision(revision)
+	objectName, err := r.resolveBase(base)
+	if err != nil {
+		return "", err
+	}
+
+	for len(operators) > 0 {
+		operator := operators[0]
+		operators = operators[1:]
+
+		if operator == '^' && strings.HasPrefix(operators, "{") {
+			peelType, rest, ok := strings.Cut(operators[1:], "}")
+			if !ok {
+				return "", ErrUnknownRevision
+			}
+			operators = rest
+			if objectName, err = r.Peel(objectName, peelType); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		digits := len(operators) - len(strings.TrimLeft(operators, "0123456789"))
+		n := 1
+		if digits > 0 {
+			n, _ = strconv.Atoi(operators[:digits])
+			operators = operators[digits:]
+		}
+
+		if operator == '^' {
+			objectName, err = r.parent(objectName, n)
+		} else {
+			for i := 0; i < n && err == nil; i++ {
+				objectName, err = r.parent(objectName, 1)
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return objectName, nil
+}
+
+// splitRevision separates a revision into its base name and the ^ and ~
+// operators that follow it.
+func splitRevision(revision string) (string, string) {
+	end := len(revision)
+	if at := strings.Index(revision, "@{"); at >= 0 {
+		if close := strings.Index(revision[at:], "}"); close >= 0 {
+			end = at + close + 1
+			if i := strings.IndexAny(revision[end:], "^~"); i >= 0 {
+				return revision[:end+i], revision[end+i:]
+			}
+			return revision, ""
+		}
+	}
+	if i := strings.IndexAny(revision[:end], "^~"); i >= 0 {
+		return revision[:i], revision[i:]
+	}
+	return revision, ""
+}
+
+func (r *Repository) resolveBase(base string) (string, error) {
+	if base == "" {
+		return "", ErrUnknownRevision
+	}
+	if base == "@" {
+		base = "HEAD"
+	}
+
+	if branch, spec, ok := strings.Cut(base, "@{"); ok {
+		spec, ok = strings.CutSuffix(spec, "}")
+		if !ok || (strings.ToLower(spec) != "upstream" && strings.ToLower(spec) != "u") {
+			return "", ErrUnknownRevision
+		}
+		if branch == "" || branch == "HEAD" {
+			current, ok, err := r.CurrentBranch()
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return "", fmt.Errorf("%w: HEAD does not point to a branch", ErrNoUpstream)
+			}
+			branch = current
+		}
+		upstream, err := r.Upstream(strings.TrimPrefix(branch, "refs/heads/"))
+		if err != nil {
+			return "", err
+		}
+		return r.ReadRef(upstream)
+	}
+
+	if object.IsName(base) {
+		return strings.ToLower(base), nil
+	}
+
+	for _, format := range refSearchOrder {
+		objectName, err := r.ReadRef(fmt.Sprintf(format, base))
+		if err == nil {
+			return objectName, nil
+		}
+		if !errors.Is(err, ErrRefNotFound) {
+			return "", err
+		}
+	}
+
+	if len(base) >= MIN_ABBREV_LENGTH && isHex(base) {
+		names, err := storage.FindPrefix(r.Objects, base)
+		if err != nil {
+			return "", err
+		}
+		if len(names) == 1 {
+			return names[0], nil
+		}
+		if len(names) > 1 {
+			return "", fmt.Errorf("%w: %s matches %s", ErrAmbiguousRevision, base, strings.Join(names, ", "))
+		}
+	}
+	return "", ErrUnknownRevision
+}
+
+func isHex(str string) bool {
+	return strings.Trim(strings.ToLower(str), "0123456789abcdef") == ""
+}
+
+// Upstream returns the remote-tracking ref that branch is configured to
+// follow through branch.<name>.remote and branch.<name>.merge.
+func (r *Repository) Upstream(branch string) (string, error) {
+	config, err := r.Config()
+	if err != nil {
+		return "", err
+	}
+	remote, hasRemote := config.Get("branch", branch, "remote")
+	merge, hasMerge := config.Get("branch", branch, "merge")
+	if !hasRemote || !hasMerge {
+		return "", fmt.Errorf("%w '%s'", ErrNoUpstream, branch)
+	}
+	if remote == "." {
+		return merge, nil
+	}
+
+	for _, spec := range config.GetAll("remote", remote, "fetch") {
+		refspec, err := ParseRefspec(spec)
+		if err != nil {
+			return "", err
+		}
+		if ref, ok := refspec.Map(merge); ok {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("%w '%s': %s is not fetched from %s", ErrNoUpstream, branch, merge, remote)
+}
+
+// Peel follows tags, and commits to their trees, until it reaches an object
+// of objectType. An empty objectType peels tags only.
+func (r *Repository) Peel(objectName string, objectType string) (string, error) {
+	if objectType != "" && object.ParseType(objectType) == object.INVALID && objectType != "object" {
+		return "", fmt.Errorf("%w: invalid object type %s", ErrUnknownRevision, objectType)
+	}
+
+	for {
+		data, actualType, err := r.Objects.Read(objectName)
+		if err != nil {
+			return "", err
+		}
+		if actualType == objectType || objectType == "object" || (objectType == "" && actualType != "tag") {
+			return objectName, nil
+		}
+
+		switch actualType {
+		case "tag":
+			tag, err := object.ParseTag(data)
+			if err != nil {
+				return "", err
+			}
+			objectName = tag.Object
+		case "commit":
+			if objectType != "tree" {
+				return "", object.CheckType(objectName, objectType, actualType)
+			}
+			commit, err := object.ParseCommit(data)
+			if err != nil {
+				return "", err
+			}
+			objectName = commit.Tree
+		default:
+			return "", object.CheckType(objectName, objectType, actualType)
+		}
+	}
+}
+
+// parent returns the n-th parent of a commit, or the commit itself for n 0.
+func (r *Repository) parent(objectName string, n int) (string, error) {
+	commitName, err := r.Peel(objectName, "commit")
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return commitName, nil
+	}
+	parents, err := r.Parents(commitName)
+	if err != nil {
+		return "", err
+	}
+	if n > len(parents) {
+		return "", fmt.Errorf("%w: %s has no parent %d", ErrUnknownRevision, commitName, n)
+	}
+	return parents[n-1], nil
+}
+
+func (r *Repository) lookupPath(tree string, path string) (string, error) {
+	objectName := tree
+	for _, component := range strings.Split(path, "/") {
+		if component == "" {
+			continue
+		}
+		entries, err := r.ReadTree(objectName)
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.Name == component {
+				objectName = hex.EncodeToString(entry.Hash)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%w: path '%s' does not exist in '%s'", ErrUnknownRevision, path, tree)
+		}
+	}
+	return objectName, nil
+}
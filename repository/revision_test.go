@@ -0,0 +1,30 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
+)
+
+func TestResolveRemoteNameToItsHead(t *testing.T) {
+	source, err := repository.Init(filepath.Join(t.TempDir(), "source"), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := commitFiles(t, source, map[string]string{"a.txt": "a\n"})
+
+	clone, err := repository.Clone("file://"+source.WorkDir, filepath.Join(t.TempDir(), "clone"), repository.CloneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// refs/remotes/origin is a directory, so origin resolves through
+	// refs/remotes/origin/HEAD.
+	resolved, err := clone.ResolveRevision("origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != commit {
+		t.Errorf("origin resolved to %s, want %s", resolved, commit)
+	}
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// Shallow returns the commits listed in .git/shallow, whose parents are
+// not in the repository. It is empty for a complete repository.
+func (r *Repository) Shallow() ([]string, error) {
+	file, err := os.Open(filepath.Join(r.GitDir, "shallow"))
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	commits := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); object.IsName(line) {
+			commits = append(commits, line)
+		}
+	}
+	return commits, scanner.Err()
+}
+
+// UpdateShallow adds and removes commits from .git/shallow, removing the
+// file once the history is complete.
+func (r *Repository) UpdateShallow(add []string, remove []string) error {
+	if len(add) == 0 && len(remove) == 0 {
+		return nil
+	}
+	commits, err := r.Shallow()
+	if err != nil {
+		return err
+	}
+
+	shallow := map[string]bool{}
+	for _, commit := range append(commits, add...) {
+		shallow[commit] = true
+	}
+	for _, commit := range remove {
+		delete(shallow, commit)
+	}
+
+	path := filepath.Join(r.GitDir, "shallow")
+	if len(shallow) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	commits = []string{}
+	for commit := range shallow {
+		commits = append(commits, commit)
+	}
+	sort.Strings(commits)
+	return writeFileAtomic(path, []byte(strings.Join(commits, "\n")+"\n"))
+}
+
+// shallowSet returns the commits in .git/shallow as a set, for walks that
+// look up many commits' parents.
+func (r *Repository) shallowSet() (map[string]bool, error) {
+	shallow, err := r.Shallow()
+	if err != nil {
+		return nil, err
+	}
+	isShallow := map[string]bool{}
+	for _, commit := range shallow {
+		isShallow[commit] = true
+	}
+	return isShallow, nil
+}
+
+// Parents returns the parents of a commit. A shallow commit has none, so
+// history walks stop there instead of failing on missing objects.
+func (r *Repository) Parents(commitName string) ([]string, error) {
+	isShallow, err := r.shallowSet()
+	if err != nil {
+		return nil, err
+	}
+	return r.parents(commitName, isShallow)
+}
+
+// parents is Parents with .git/shallow already read into isShallow.
+func (r *Repository) parents(commitName string, isShallow map[string]bool) ([]string, error) {
+	commit, err := r.ReadCommit(commitName)
+	if err != nil {
+		return nil, err
+	}
+	if isShallow[commitName] {
+		return []string{}, nil
+	}
+	return commit.Parents, nil
+}
+
+// DeepenBoundary walks depth generations of history down from wants, as
+// for a "deepen <depth>" request, where depth 1 is the wants themselves. It
+// returns the commits of the last generation that have parents, where the
+// shallow history stops, and every commit the walk reached.
+func (r *Repository) DeepenBoundary(wants []string, depth int) ([]string, map[string]bool, error) {
+	isShallow, err := r.shallowSet()
+	if err != nil {
+		return nil, nil, err
+	}
+	boundary := []string{}
+	reached := map[string]bool{}
+	generation := wants
+	for level := 1; len(generation) > 0; level++ {
+		parents := []string{}
+		for _, commitName := range generation {
+			if reached[commitName] {
+				continue
+			}
+			reached[commitName] = true
+			commitParents, err := r.parents(commitName, isShallow)
+			if err != nil {
+				return nil, nil, err
+			}
+			if level < depth {
+				parents = append(parents, commitParents...)
+			} else if len(commitParents) > 0 {
+				boundary = append(boundary, commitName)
+			}
+		}
+		generation = parents
+	}
+	return boundary, reached, nil
+}
+
+// ErrNoShallowCommits is returned when a deepen-since or deepen-not request
+// leaves out every commit it asks for.
+var ErrNoShallowCommits = errors.New("no commits selected for shallow requests")
+
+// DeepenRevList walks the history of wants that is committed at or after
+// since, when it is set, and not reachable from any of notCommits, as for
+// "deepen-since" and "deepen-not" requests. It returns the commits with a
+// parent left out, where the shallow history stops, and every commit the
+// walk kept.
+func (r *Repository) DeepenRevList(wants []string, since time.Time, notCommits []string) ([]string, map[string]bool, error) {
+	excluded := map[string]bool{}
+	err := r.WalkHistory(notCommits, func(commitName string, commit *object.Commit) error {
+		excluded[commitName] = true
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	keep := func(commitName string, commit *object.Commit) bool {
+		return !excluded[commitName] && (since.IsZero() || !object.SignatureTime(commit.Committer).Before(since))
+	}
+
+	isShallow, err := r.shallowSet()
+	if err != nil {
+		return nil, nil, err
+	}
+	boundary := []string{}
+	reached := map[string]bool{}
+	stack := []string{}
+	for _, want := range wants {
+		commit, err := r.ReadCommit(want)
+		if err != nil {
+			return nil, nil, err
+		}
+		if keep(want, commit) {
+			stack = append(stack, want)
+		}
+	}
+	for len(stack) > 0 {
+		commitName := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reached[commitName] {
+			continue
+		}
+		reached[commitName] = true
+		parents, err := r.parents(commitName, isShallow)
+		if err != nil {
+			return nil, nil, err
+		}
+		cut := false
+		for _, parent := range parents {
+			commit, err := r.ReadCommit(parent)
+			if err != nil {
+				return nil, nil, err
+			}
+			if keep(parent, commit) {
+				stack = append(stack, parent)
+			} else {
+				cut = true
+			}
+		}
+		if cut {
+			boundary = append(boundary, commitName)
+		}
+	}
+	if len(reached) == 0 {
+		return nil, nil, ErrNoShallowCommits
+	}
+	return boundary, reached, nil
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+// ReadTree reads and parses the tree named treeHash.
+func (r *Repository) ReadTree(treeHash string) ([]object.TreeEntry, error) {
+	content, objectType, err := r.Objects.Read(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := object.CheckType(treeHash, "tree", objectType); err != nil {
+		return nil, err
+	}
+	return object.ParseTree(content)
+}
+
+// WriteTree stores the whole work tree, skipping the .git directory, and
+// returns the name of the root tree.
+func (r *Repository) WriteTree() ([]byte, error) {
+	tree, err := r.generateTreeFromDir(r.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	return r.Objects.Write("tree", tree.Bytes())
+}
+
+func (r *Repository) generateTreeFromDir(dirname string) (object.Tree, error) {
+	var tree object.Tree
+
+	files, err := os.ReadDir(dirname)
+	if err != nil {
+		return tree, err
+	}
+
+	for _, file := range files {
+		filePath := filepath.Join(dirname, file.Name()) // full path of the file
+		if file.IsDir() {
+			// Skip the .git directory
+			if file.Name() == GIT_DIR {
+				continue
+			}
+
+			newTree, err := r.generateTreeFromDir(filePath)
+			if err != nil {
+				return tree, err
+			}
+			treeSha, err := r.Objects.Write("tree", newTree.Bytes())
+			if err != nil {
+				return tree, err
+			}
+			tree.Entries = append(tree.Entries, object.TreeEntry{
+				Mode:   object.DIR,
+				Name:   file.Name(),
+				Hash:   treeSha,
+				Object: object.TREE,
+			})
+		} else {
+			shaCode, err := r.HashFile(filePath)
+			if err != nil {
+				return tree, err
+			}
+			tree.Entries = append(tree.Entries, object.TreeEntry{
+				Mode:   object.REGULAR_FILE,
+				Name:   file.Name(),
+				Hash:   shaCode,
+				Object: object.BLOB,
+			})
+		}
+	}
+
+	return tree, nil
+}
+
+// Checkout writes the tree of commitHash into the work tree.
+func (r *Repository) Checkout(commitHash string) error {
+	commit, err := r.ReadCommit(commitHash)
+	if err != nil {
+		return err
+	}
+
+	// In a partial clone, fetch every missing blob in one request instead
+	// of one request per file.
+	if prefetcher, ok := r.Objects.(storage.Prefetcher); ok {
+		blobs, err := r.treeBlobs(commit.Tree)
+		if err != nil {
+			return err
+		}
+		if err := prefetcher.Prefetch(blobs); err != nil {
+			return err
+		}
+	}
+	return r.checkoutTree(commit.Tree, r.WorkDir)
+}
+
+// treeBlobs returns the names of the files in a tree and its subtrees.
+func (r *Repository) treeBlobs(treeHash string) ([]string, error) {
+	treeEntries, err := r.ReadTree(treeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := []string{}
+	for _, entry := range treeEntries {
+		hashStr := hex.EncodeToString(entry.Hash)
+		switch entry.Mode {
+		case object.DIR:
+			subtreeBlobs, err := r.treeBlobs(hashStr)
+			if err != nil {
+				return nil, err
+			}
+			blobs = append(blobs, subtreeBlobs...)
+		case object.REGULAR_FILE, object.EXECUTABLE_FILE:
+			blobs = append(blobs, hashStr)
+		}
+	}
+	return blobs, nil
+}
+
+func (r *Repository) checkoutTree(treeHash, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	treeEntries, err := r.ReadTree(treeHash)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range treeEntries {
+		hashStr := hex.EncodeToString(entry.Hash)
+		fullPath := filepath.Join(dir, entry.Name)
+
+		if entry.Mode == object.DIR {
+			err = r.checkoutTree(hashStr, fullPath)
+			if err != nil {
+				return err
+			}
+		} else if entry.Mode == object.EXECUTABLE_FILE || entry.Mode == object.REGULAR_FILE {
+			blob, objectType, err := r.Objects.Read(hashStr)
+			if err != nil {
+				return err
+			}
+			if err := object.CheckType(hashStr, "blob", objectType); err != nil {
+				return err
+			}
+			perm := os.FileMode(0644)
+			if entry.Mode == object.EXECUTABLE_FILE {
+				perm = 0755
+			}
+			if err := os.WriteFile(fullPath, blob, perm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
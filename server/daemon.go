@@ -0,0 +1,152 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
+)
+
+// DAEMON_EXPORT_OK is the file in a git directory that lets Daemon serve
+// the repository.
+const DAEMON_EXPORT_OK = "git-daemon-export-ok"
+
+// Daemon serves repositories over the git:// protocol, like git daemon.
+// Each connection opens with a request line, "<service> <path>\0host=
+// <host>\0", which may carry "\0version=2\0" after it, and then speaks the
+// service's protocol until the client is done.
+type Daemon struct {
+	// BasePath is prepended to every requested path. Without it, paths
+	// are taken as absolute.
+	BasePath string
+	// Directories, when any are given, are the only directories whose
+	// repositories, and those below them, are served.
+	Directories []string
+	// ExportAll serves repositories that have no DAEMON_EXPORT_OK file.
+	ExportAll bool
+	// ReceivePack enables pushing to repositories that do not set
+	// daemon.receivepack themselves.
+	ReceivePack bool
+	// ErrorLog receives the errors of failed connections. The log
+	// package's standard logger is used when it is nil.
+	ErrorLog *log.Logger
+}
+
+func NewDaemon(basePath string) *Daemon {
+	return &Daemon{BasePath: basePath}
+}
+
+func (d *Daemon) logf(format string, args ...any) {
+	if d.ErrorLog != nil {
+		d.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Serve accepts connections on listener, serving each in its own
+// goroutine, until accepting fails.
+func (d *Daemon) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go d.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single connection and closes it.
+func (d *Daemon) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	if err := d.serve(conn); err != nil {
+		d.logf("%s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// parseDaemonRequest splits a request line into the service, the path and
+// the protocol version asked for in its extra parameters.
+func parseDaemonRequest(line string) (string, string, int, error) {
+	service, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return "", "", 0, protocolError("bad request line %q", line)
+	}
+	repoPath, parameters, _ := strings.Cut(rest, "\x00")
+	_, extra, _ := strings.Cut(parameters, "\x00\x00")
+	version := ProtocolVersion(strings.ReplaceAll(strings.TrimSuffix(extra, "\x00"), "\x00", ":"))
+	return service, repoPath, version, nil
+}
+
+// findRepository opens the repository at repoPath if it may be served:
+// it must be within Directories, when they are set, and exported.
+func (d *Daemon) findRepository(repoPath string) *repository.Repository {
+	var dir string
+	if d.BasePath != "" {
+		dir = filepath.Join(d.BasePath, filepath.FromSlash(path.Clean("/"+repoPath)))
+	} else if path.IsAbs(repoPath) {
+		dir = filepath.FromSlash(path.Clean(repoPath))
+	} else {
+		return nil
+	}
+
+	allowed := len(d.Directories) == 0
+	for _, directory := range d.Directories {
+		relative, err := filepath.Rel(directory, dir)
+		if err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil
+	}
+
+	repo := repository.Find(dir)
+	if repo == nil {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, DAEMON_EXPORT_OK)); err != nil && !d.ExportAll {
+		return nil
+	}
+	return repo
+}
+
+// serve reads the request line and runs the service it names. Refusals are
+// sent to the client as an ERR line, as git daemon does, without saying
+// whether the repository exists.
+func (d *Daemon) serve(conn io.ReadWriter) error {
+	_, line, err := readLine(conn)
+	if err != nil {
+		return err
+	}
+	service, repoPath, version, err := parseDaemonRequest(line)
+	if err != nil {
+		return err
+	}
+	if service != "git-upload-pack" && service != "git-receive-pack" {
+		writePacket(conn, fmt.Sprintf("ERR service not enabled: %s\n", service))
+		return fmt.Errorf("unknown service %q", service)
+	}
+
+	repo := d.findRepository(repoPath)
+	if repo == nil {
+		writePacket(conn, fmt.Sprintf("ERR access denied or repository not exported: %s\n", repoPath))
+		return fmt.Errorf("%s %s: access denied or repository not exported", service, repoPath)
+	}
+	if !serviceEnabled(repo, "daemon", service, d.ReceivePack) {
+		writePacket(conn, fmt.Sprintf("ERR service not enabled: %s\n", service))
+		return fmt.Errorf("%s %s: service not enabled", service, repoPath)
+	}
+
+	options := Options{Version: version}
+	if service == "git-receive-pack" {
+		options.Version = 0
+		return ReceivePack(repo, conn, conn, options)
+	}
+	return UploadPack(repo, conn, conn, options)
+}
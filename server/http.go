@@ -0,0 +1,112 @@
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/repository"
+)
+
+// Handler serves the repositories below Root over git's smart HTTP
+// protocol, like git http-backend: GET <repo>/info/refs?service=<service>
+// for the ref advertisement, and POST <repo>/git-upload-pack and
+// <repo>/git-receive-pack for the exchanges.
+type Handler struct {
+	Root string
+	// ReceivePack enables pushing to repositories that do not set
+	// http.receivepack themselves.
+	ReceivePack bool
+	// ErrorLog receives the errors of failed requests. The log package's
+	// standard logger is used when it is nil.
+	ErrorLog *log.Logger
+}
+
+func NewHandler(root string) *Handler {
+	return &Handler{Root: root}
+}
+
+func (h *Handler) logf(format string, args ...any) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// findRepository opens the repository at the path relative to Root.
+func (h *Handler) findRepository(repoPath string) *repository.Repository {
+	repoPath = path.Clean("/" + repoPath)
+	return repository.Find(filepath.Join(h.Root, filepath.FromSlash(repoPath)))
+}
+
+func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	var repoPath, service string
+	advertise := false
+	switch {
+	case request.Method == http.MethodGet && strings.HasSuffix(request.URL.Path, "/info/refs"):
+		repoPath = strings.TrimSuffix(request.URL.Path, "/info/refs")
+		service = request.URL.Query().Get("service")
+		advertise = true
+	case request.Method == http.MethodPost && strings.HasSuffix(request.URL.Path, "/git-upload-pack"):
+		repoPath, service = strings.TrimSuffix(request.URL.Path, "/git-upload-pack"), "git-upload-pack"
+	case request.Method == http.MethodPost && strings.HasSuffix(request.URL.Path, "/git-receive-pack"):
+		repoPath, service = strings.TrimSuffix(request.URL.Path, "/git-receive-pack"), "git-receive-pack"
+	default:
+		http.NotFound(writer, request)
+		return
+	}
+	if service != "git-upload-pack" && service != "git-receive-pack" {
+		http.Error(writer, "dumb HTTP is not supported", http.StatusForbidden)
+		return
+	}
+
+	repo := h.findRepository(repoPath)
+	if repo == nil {
+		http.NotFound(writer, request)
+		return
+	}
+	if !serviceEnabled(repo, "http", service, h.ReceivePack) {
+		http.Error(writer, fmt.Sprintf("%s is disabled", service), http.StatusForbidden)
+		return
+	}
+
+	var body io.Reader = request.Body
+	if request.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(request.Body)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+
+	options := Options{AdvertiseRefs: advertise, StatelessRPC: true, Version: ProtocolVersion(request.Header.Get("Git-Protocol"))}
+	if service == "git-receive-pack" {
+		options.Version = 0
+	}
+	writer.Header().Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+	if advertise {
+		writer.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+		if options.Version != 2 {
+			io.WriteString(writer, pktline.Encode(fmt.Sprintf("# service=%s\n", service))+pktline.FLUSH)
+		}
+	} else {
+		writer.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", service))
+	}
+
+	serve := UploadPack
+	if service == "git-receive-pack" {
+		serve = ReceivePack
+	}
+	if err := serve(repo, body, writer, options); err != nil {
+		h.logf("%s %s: %v", service, repoPath, err)
+	}
+}
@@ -0,0 +1,167 @@
+package server_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/repository"
+	"github.com/codecrafters-io/git-starter-go/server"
+)
+
+// commitFile writes a file into the work tree of repo and commits the
+// whole tree on main.
+func commitFile(t *testing.T, repo *repository.Repository, name, content string, parents ...string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(repo.WorkDir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.WriteTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitTree(hex.EncodeToString(tree), parents, "commit", "Test", "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/heads/main", hex.EncodeToString(commit)); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(commit)
+}
+
+// serveRepository serves a new repository with one commit over smart
+// HTTP, pushing included, and returns it with its URL.
+func serveRepository(t *testing.T) (*repository.Repository, string) {
+	t.Helper()
+	root := t.TempDir()
+	source, err := repository.Init(filepath.Join(root, "source"), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, source, "a.txt", "first\n")
+	handler := server.NewHandler(root)
+	handler.ReceivePack = true
+	handler.ErrorLog = log.New(io.Discard, "", 0)
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+	return source, httpServer.URL + "/source"
+}
+
+func TestHTTPCloneAndPush(t *testing.T) {
+	source, url := serveRepository(t)
+	head, err := source.ReadRef("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := repository.Clone(url, filepath.Join(t.TempDir(), "clone"), repository.CloneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cloned, err := clone.ReadRef("refs/remotes/origin/main"); err != nil || cloned != head {
+		t.Fatalf("cloned origin/main is %q (%v), want %s", cloned, err, head)
+	}
+
+	pushed := commitFile(t, clone, "b.txt", "second\n", head)
+	updates, err := clone.Push("origin", []string{"refs/heads/main:refs/heads/topic"}, repository.PushOptions{})
+	if err != nil {
+		t.Fatalf("push failed: %v (%+v)", err, updates)
+	}
+	if topic, err := source.ReadRef("refs/heads/topic"); err != nil || topic != pushed {
+		t.Fatalf("pushed topic is %q (%v), want %s", topic, err, pushed)
+	}
+	if !source.Objects.Has(hex.EncodeToString(object.Hash("blob", []byte("second\n")))) {
+		t.Error("pushed blob is missing from the served repository")
+	}
+}
+
+func TestHTTPFetchOnlyServesReachableWants(t *testing.T) {
+	source, url := serveRepository(t)
+	head, err := source.ReadRef("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A commit that no ref points at.
+	dangling, err := source.CommitTree(hex.EncodeToString(object.Hash("tree", nil)), []string{head}, "dangling", "Test", "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reachableBlob := hex.EncodeToString(object.Hash("blob", []byte("first\n")))
+
+	fetch := func(want string) string {
+		t.Helper()
+		body := pktline.Encode("command=fetch\n") + pktline.Encode("object-format=sha1\n") + pktline.DELIM +
+			pktline.Encode("want "+want+"\n") + pktline.Encode("done\n") + pktline.FLUSH
+		request, err := http.NewRequest(http.MethodPost, url+"/git-upload-pack", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+		request.Header.Set("Git-Protocol", "version=2")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		data, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if response := fetch(reachableBlob); !strings.Contains(response, "packfile\n") {
+		t.Errorf("fetching a reachable blob got %q, want a pack", response)
+	}
+	if response := fetch(hex.EncodeToString(dangling)); !strings.Contains(response, "ERR upload-pack: not our ref") {
+		t.Errorf("fetching an unreachable commit got %q, want not our ref", response)
+	}
+}
+
+func TestHTTPRejectedPushLeavesNoPack(t *testing.T) {
+	source, url := serveRepository(t)
+	config, err := source.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Set("receive", "", "denyNonFastForwards", "true")
+	if err := source.WriteConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	clone, err := repository.Clone(url, filepath.Join(t.TempDir(), "clone"), repository.CloneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	countPacks := func() int {
+		t.Helper()
+		packs, err := filepath.Glob(filepath.Join(source.GitDir, "objects", "pack", "pack-*.pack"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(packs)
+	}
+	before := countPacks()
+
+	// A root commit forced over main is not a fast-forward.
+	commitFile(t, clone, "b.txt", "unrelated\n")
+	_, err = clone.Push("origin", []string{"refs/heads/main:refs/heads/main"}, repository.PushOptions{Force: true})
+	if !errors.Is(err, repository.ErrPushRejected) {
+		t.Fatalf("push returned %v, want %v", err, repository.ErrPushRejected)
+	}
+	if after := countPacks(); after != before {
+		t.Errorf("rejected push left %d packs, want %d", after, before)
+	}
+	if incoming, _ := filepath.Glob(filepath.Join(source.GitDir, "objects", "incoming-*")); len(incoming) > 0 {
+		t.Errorf("rejected push left %v", incoming)
+	}
+}
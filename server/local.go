@@ -0,0 +1,31 @@
+package server
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/codecrafters-io/git-starter-go/repository"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+func init() {
+	transport.RegisterLocalServer(serveLocal)
+}
+
+// serveLocal answers the requests of a client cloning, fetching from or
+// pushing to a repository on disk, the way Handler answers them over HTTP.
+func serveLocal(path, service string, version int, request io.Reader, response io.Writer) error {
+	repo := repository.Find(path)
+	if repo == nil {
+		return fmt.Errorf("'%s' %w", path, transport.ErrNotRepository)
+	}
+	options := Options{AdvertiseRefs: request == nil, StatelessRPC: true, Version: version}
+	switch service {
+	case "git-upload-pack":
+		return UploadPack(repo, request, response, options)
+	case "git-receive-pack":
+		options.Version = 0
+		return ReceivePack(repo, request, response, options)
+	}
+	return protocolError("unknown service %q", service)
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/repository"
+	"github.com/codecrafters-io/git-starter-go/storage"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// RECEIVE_CAPABILITIES are advertised by receive-pack.
+const RECEIVE_CAPABILITIES = "report-status delete-refs side-band-64k quiet atomic ofs-delta object-format=sha1 agent=" + transport.AGENT
+
+// receiveCommand is one ref update a client sent, with the reason it was
+// refused, if it was.
+type receiveCommand struct {
+	transport.PushCommand
+	Error string
+
+	// lock is held on the ref from before it is checked until it is
+	// updated, and previous is the value it had then.
+	lock     *repository.RefLock
+	previous string
+}
+
+// readCommands reads the ref update commands up to the flush, along with
+// the capabilities on the first one. The shallow lines a shallow client
+// sends first are skipped.
+func readCommands(reader io.Reader) ([]*receiveCommand, transport.Capabilities, error) {
+	commands := []*receiveCommand{}
+	capabilities := transport.Capabilities{}
+	for {
+		special, line, err := readLine(reader)
+		if errors.Is(err, io.EOF) && len(commands) == 0 {
+			return commands, capabilities, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if special == pktline.FLUSH {
+			return commands, capabilities, nil
+		}
+		if strings.HasPrefix(line, "shallow ") {
+			continue
+		}
+
+		line, capabilityList, ok := strings.Cut(line, "\x00")
+		if ok && len(commands) == 0 {
+			capabilities = transport.ParseCapabilities(capabilityList)
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, nil, protocolError("bad command %q", line)
+		}
+		commands = append(commands, &receiveCommand{
+			PushCommand: transport.PushCommand{Old: fields[0], New: fields[1], Name: fields[2]},
+		})
+	}
+}
+
+// checkCommand works out why command must be refused, if it must: a bad
+// name, a stale old value, a new value whose history is not all here down
+// to the existing refs in haves, or one of the receive.deny* settings.
+func checkCommand(repo *repository.Repository, config *repository.Config, command *receiveCommand, haves []string) (string, error) {
+	if !strings.HasPrefix(command.Name, "refs/") || !repository.CheckRefFormat(command.Name) {
+		return "funny refname", nil
+	}
+	deleting := command.New == transport.ZERO_ID
+
+	lock, err := repo.LockRef(command.Name)
+	if err != nil {
+		return "failed to lock", nil
+	}
+	command.lock = lock
+	current, err := repo.ReadRef(command.Name)
+	if errors.Is(err, repository.ErrRefNotFound) {
+		current = transport.ZERO_ID
+	} else if err != nil {
+		return "", err
+	}
+	command.previous = current
+	if command.Old != current && !(deleting && command.Old == transport.ZERO_ID) {
+		return "failed to update ref", nil
+	}
+	if !deleting {
+		connected, err := repo.IsConnected([]string{command.New}, haves)
+		if err != nil {
+			return "", err
+		}
+		if !connected {
+			return "missing necessary objects", nil
+		}
+	}
+
+	if repo.WorkDir != "" {
+		branch, ok, err := repo.CurrentBranch()
+		if err != nil {
+			return "", err
+		}
+		denyCurrentBranch, _ := config.Get("receive", "", "denyCurrentBranch")
+		switch strings.ToLower(denyCurrentBranch) {
+		case "ignore", "warn", "false", "no", "off", "0":
+		default:
+			if ok && command.Name == "refs/heads/"+branch {
+				if deleting {
+					return "deletion of the current branch prohibited", nil
+				}
+				return "branch is currently checked out", nil
+			}
+		}
+	}
+
+	if deleting {
+		if config.Bool("receive", "", "denyDeletes") {
+			return "deletion prohibited", nil
+		}
+		return "", nil
+	}
+	if current != transport.ZERO_ID && config.Bool("receive", "", "denyNonFastForwards") {
+		oldCommit, err := repo.Peel(current, "commit")
+		if err != nil {
+			return "", nil
+		}
+		newCommit, err := repo.Peel(command.New, "commit")
+		if err != nil {
+			return "non-fast-forward", nil
+		}
+		if ok, err := repo.IsAncestor(oldCommit, newCommit); err != nil || !ok {
+			return "non-fast-forward", err
+		}
+	}
+	return "", nil
+}
+
+// updateRefs checks and applies commands, holding the lock on each ref
+// from before it is read until it is written. With atomic, a single
+// refusal or failed update leaves every ref as it was. migrate is called
+// once some command has passed its checks, before any ref is updated.
+func updateRefs(repo *repository.Repository, commands []*receiveCommand, atomic bool, migrate func() error) error {
+	defer func() {
+		for _, command := range commands {
+			if command.lock != nil {
+				command.lock.Unlock()
+			}
+		}
+	}()
+
+	config, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	refs, err := repo.Refs("refs/")
+	if err != nil {
+		return err
+	}
+	haves := []string{}
+	for _, hash := range refs {
+		haves = append(haves, hash)
+	}
+
+	failed := false
+	for _, command := range commands {
+		if command.Error != "" {
+			failed = true
+			continue
+		}
+		if command.Error, err = checkCommand(repo, config, command, haves); err != nil {
+			return err
+		}
+		failed = failed || command.Error != ""
+	}
+	if atomic && failed {
+		failAtomic(commands)
+		return nil
+	}
+	if !slices.ContainsFunc(commands, func(command *receiveCommand) bool { return command.Error == "" }) {
+		return nil
+	}
+	if err := migrate(); err != nil {
+		for _, command := range commands {
+			if command.Error == "" {
+				command.Error = "unable to migrate objects to permanent storage"
+			}
+		}
+		return nil
+	}
+
+	applied := []*receiveCommand{}
+	for _, command := range commands {
+		if command.Error != "" {
+			continue
+		}
+		lock := command.lock
+		command.lock = nil
+		if command.New == transport.ZERO_ID {
+			err = lock.Delete()
+		} else {
+			err = lock.Update(command.New)
+		}
+		if err != nil {
+			command.Error = "failed to update ref"
+			if atomic {
+				rollBack(repo, applied)
+				failAtomic(commands)
+				return nil
+			}
+			continue
+		}
+		applied = append(applied, command)
+	}
+	return nil
+}
+
+// failAtomic refuses every command of a failed atomic push.
+func failAtomic(commands []*receiveCommand) {
+	for _, command := range commands {
+		if command.Error == "" {
+			command.Error = "atomic push failure"
+		}
+	}
+}
+
+// rollBack puts the refs of commands back to the values they had before
+// they were updated.
+func rollBack(repo *repository.Repository, commands []*receiveCommand) {
+	for _, command := range commands {
+		if command.previous == transport.ZERO_ID {
+			repo.DeleteRef(command.Name)
+		} else {
+			repo.UpdateRef(command.Name, command.previous)
+		}
+		command.Error = "atomic push failure"
+	}
+}
+
+// ReceivePack serves a push to repo: it reads the ref update commands and
+// the pack from reader, updates the refs it may, and writes the
+// report-status to writer. The pack is only kept when some update is
+// accepted.
+func ReceivePack(repo *repository.Repository, reader io.Reader, writer io.Writer, options Options) error {
+	if options.AdvertiseRefs || !options.StatelessRPC {
+		refs, err := repo.Refs("refs/")
+		if err != nil {
+			return err
+		}
+		advertised := []advertisedRef{}
+		for name, hash := range refs {
+			advertised = append(advertised, advertisedRef{Name: name, Hash: hash})
+		}
+		sort.Slice(advertised, func(i, j int) bool { return advertised[i].Name < advertised[j].Name })
+		if err := writeAdvertisement(writer, advertised, RECEIVE_CAPABILITIES); err != nil || options.AdvertiseRefs {
+			return err
+		}
+	}
+
+	commands, capabilities, err := readCommands(reader)
+	if err != nil || len(commands) == 0 {
+		return err
+	}
+
+	output := bufio.NewWriter(writer)
+	var report, progress io.Writer = output, nil
+	if capabilities.Has("side-band-64k") {
+		report = newSideBandWriter(output, 1, MAX_SIDE_BAND_64K_DATA)
+		if !capabilities.Has("quiet") {
+			progress = newSideBandWriter(output, 2, MAX_SIDE_BAND_64K_DATA)
+		}
+	}
+
+	// A pack comes unless every command is a deletion. It is quarantined,
+	// where the checks can read it, until some ref update is accepted.
+	unpack := "ok"
+	checked, migrate := repo, func() error { return nil }
+	if slices.ContainsFunc(commands, func(command *receiveCommand) bool { return command.New != transport.ZERO_ID }) {
+		quarantine, err := storage.NewQuarantine(repo.GitDir, repo.Objects)
+		if err != nil {
+			return err
+		}
+		defer quarantine.Remove()
+		checked = &repository.Repository{WorkDir: repo.WorkDir, GitDir: repo.GitDir, Objects: quarantine.Objects}
+		migrate = quarantine.Migrate
+		if _, err := quarantine.StorePackfile(reader, progress); err != nil {
+			unpack = err.Error()
+			for _, command := range commands {
+				command.Error = "unpacker error"
+			}
+		}
+	}
+	if err := updateRefs(checked, commands, capabilities.Has("atomic"), migrate); err != nil {
+		return err
+	}
+
+	if capabilities.Has("report-status") {
+		status := pktline.Encode(fmt.Sprintf("unpack %s\n", unpack))
+		for _, command := range commands {
+			if command.Error == "" {
+				status += pktline.Encode(fmt.Sprintf("ok %s\n", command.Name))
+			} else {
+				status += pktline.Encode(fmt.Sprintf("ng %s %s\n", command.Name, command.Error))
+			}
+		}
+		io.WriteString(report, status+pktline.FLUSH)
+	}
+	if capabilities.Has("side-band-64k") {
+		io.WriteString(output, pktline.FLUSH)
+	}
+	return output.Flush()
+}
@@ -0,0 +1,179 @@
+// Package server implements the serving side of git's pack protocols,
+// upload-pack for fetches and receive-pack for pushes, and exposes both
+// over smart HTTP, the git:// daemon protocol, and to in-process clients of
+// repositories on disk.
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/repository"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+const (
+	// MAX_SIDE_BAND_64K_DATA and MAX_SIDE_BAND_DATA are the largest
+	// payloads of one side-band packet, after the channel byte.
+	MAX_SIDE_BAND_64K_DATA = 65515
+	MAX_SIDE_BAND_DATA     = 995
+)
+
+// Options control how much of an exchange UploadPack and ReceivePack
+// serve.
+type Options struct {
+	// AdvertiseRefs sends the ref advertisement, or the protocol v2
+	// capabilities, and stops, as for GET info/refs.
+	AdvertiseRefs bool
+	// StatelessRPC serves one request of a stateless transport such as
+	// smart HTTP: nothing is advertised first, and the server stops after
+	// a single round of negotiation or a single v2 command.
+	StatelessRPC bool
+	// Version is the protocol version the client asked for, 0 or 2.
+	// receive-pack always speaks version 0.
+	Version int
+}
+
+// serviceEnabled reports whether service may be used on repo over the
+// transport whose config section is section, "http" or "daemon". Pushing
+// is off unless receivePack enables it or <section>.receivepack is set,
+// and fetching is on unless <section>.uploadpack turns it off.
+func serviceEnabled(repo *repository.Repository, section string, service string, receivePack bool) bool {
+	config, err := repo.Config()
+	if err != nil {
+		return false
+	}
+	key, enabled := "uploadpack", true
+	if service == "git-receive-pack" {
+		key, enabled = "receivepack", receivePack
+	}
+	if _, ok := config.Get(section, "", key); ok {
+		enabled = config.Bool(section, "", key)
+	}
+	return enabled
+}
+
+// ProtocolVersion returns the version asked for in parameters, the colon
+// separated list such as "version=2" that clients send in the Git-Protocol
+// header or the GIT_PROTOCOL environment variable.
+func ProtocolVersion(parameters string) int {
+	for _, parameter := range strings.Split(parameters, ":") {
+		if parameter == "version=2" {
+			return 2
+		}
+	}
+	return 0
+}
+
+func protocolError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", pktline.ErrProtocol, fmt.Sprintf(format, args...))
+}
+
+// writePacket frames line as a pkt-line on writer.
+func writePacket(writer io.Writer, line string) error {
+	_, err := io.WriteString(writer, pktline.Encode(line))
+	return err
+}
+
+// readLine reads one pkt-line from reader and returns it without its
+// trailing newline, or the special packet it was.
+func readLine(reader io.Reader) (string, string, error) {
+	special, data, err := pktline.ReadPacket(reader)
+	return special, strings.TrimSuffix(string(data), "\n"), err
+}
+
+// sideBandWriter sends everything written to it on one side-band channel,
+// split into packets of at most max bytes.
+type sideBandWriter struct {
+	writer  io.Writer
+	channel byte
+	max     int
+}
+
+func newSideBandWriter(writer io.Writer, channel byte, max int) *sideBandWriter {
+	return &sideBandWriter{writer: writer, channel: channel, max: max}
+}
+
+func (w *sideBandWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), w.max)
+		packet := append([]byte(fmt.Sprintf("%04x%c", n+5, w.channel)), p[:n]...)
+		if _, err := w.writer.Write(packet); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// advertisedRef is a ref as it is listed to clients. Peeled is set for
+// annotated tags and Target for symbolic refs.
+type advertisedRef struct {
+	Name   string
+	Hash   string
+	Peeled string
+	Target string
+}
+
+// listRefs returns HEAD, when it resolves, followed by every ref under
+// refs/ in name order, with annotated tags peeled.
+func listRefs(repo *repository.Repository) ([]advertisedRef, error) {
+	refs, err := repo.Refs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	advertised := []advertisedRef{}
+	if head, err := repo.ReadRef("HEAD"); err == nil {
+		target, _, err := repo.ReadSymbolicRef("HEAD")
+		if err != nil {
+			return nil, err
+		}
+		advertised = append(advertised, advertisedRef{Name: "HEAD", Hash: head, Target: target})
+	}
+	for _, name := range names {
+		advertised = append(advertised, advertisedRef{Name: name, Hash: refs[name]})
+	}
+	for i := range advertised {
+		peeled, err := repo.Peel(advertised[i].Hash, "")
+		if err != nil {
+			return nil, err
+		}
+		if peeled != advertised[i].Hash {
+			advertised[i].Peeled = peeled
+		}
+	}
+	return advertised, nil
+}
+
+// writeAdvertisement writes a protocol v0 ref advertisement, with
+// capabilities after the first ref, and the flush that ends it.
+func writeAdvertisement(writer io.Writer, refs []advertisedRef, capabilities string) error {
+	output := bufio.NewWriter(writer)
+	if len(refs) == 0 {
+		writePacket(output, fmt.Sprintf("%s capabilities^{}\x00%s\n", transport.ZERO_ID, capabilities))
+	}
+	for i, ref := range refs {
+		line := fmt.Sprintf("%s %s", ref.Hash, ref.Name)
+		if i == 0 {
+			line += "\x00" + capabilities
+		}
+		writePacket(output, line+"\n")
+		if ref.Peeled != "" {
+			writePacket(output, fmt.Sprintf("%s %s^{}\n", ref.Peeled, ref.Name))
+		}
+	}
+	io.WriteString(output, pktline.FLUSH)
+	return output.Flush()
+}
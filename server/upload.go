@@ -0,0 +1,538 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/packfile"
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/repository"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// ErrNotOurRef is returned when a client wants an object the repository
+// does not have.
+var ErrNotOurRef = errors.New("not our ref")
+
+// upload is the state of one upload-pack request: what the client wants,
+// what it has, and where its shallow history stops.
+type upload struct {
+	repo          *repository.Repository
+	wants         []string
+	clientShallow []string
+	depth         int
+	// deepenRelative counts depth from the client's shallow commits
+	// rather than from the wants.
+	deepenRelative bool
+	deepenSince    time.Time
+	deepenNot      []string
+	common         []string
+	isCommon       map[string]bool
+	// ready is set once the common commits cover every want, as checked
+	// when common held readyChecked of them.
+	ready        bool
+	readyChecked int
+	// includeTag adds the annotated tags that point into the pack.
+	includeTag bool
+	// offsetDeltas is set for clients that read OBJ_OFS_DELTA.
+	offsetDeltas bool
+	// filter leaves trees and blobs out of the pack for a partial clone.
+	filter transport.Filter
+
+	// boundary lists the commits whose parents are left out of the pack,
+	// and include the commits to send in addition to the wants.
+	boundary []string
+	include  []string
+}
+
+func newUpload(repo *repository.Repository) *upload {
+	return &upload{repo: repo, isCommon: map[string]bool{}}
+}
+
+// parseArgument records a want, shallow, deepen or filter line, and reports
+// whether line was one. Wanted objects must exist here; checkWants then
+// decides whether the client may have them.
+func (u *upload) parseArgument(line string) (bool, error) {
+	switch {
+	case strings.HasPrefix(line, "want "):
+		want := strings.Fields(line)[1]
+		if !object.IsName(want) || !u.repo.Objects.Has(want) {
+			return true, fmt.Errorf("%w %s", ErrNotOurRef, want)
+		}
+		u.wants = append(u.wants, want)
+	case strings.HasPrefix(line, "shallow "):
+		commit := strings.TrimPrefix(line, "shallow ")
+		if !object.IsName(commit) {
+			return true, protocolError("bad shallow line %q", line)
+		}
+		u.clientShallow = append(u.clientShallow, commit)
+	case strings.HasPrefix(line, "deepen "):
+		depth, err := strconv.Atoi(strings.TrimPrefix(line, "deepen "))
+		if err != nil || depth <= 0 {
+			return true, protocolError("invalid deepen: %s", strings.TrimPrefix(line, "deepen "))
+		}
+		u.depth = depth
+	case line == "deepen-relative":
+		u.deepenRelative = true
+	case strings.HasPrefix(line, "deepen-since "):
+		seconds, err := strconv.ParseInt(strings.TrimPrefix(line, "deepen-since "), 10, 64)
+		if err != nil {
+			return true, protocolError("invalid deepen-since: %s", strings.TrimPrefix(line, "deepen-since "))
+		}
+		u.deepenSince = time.Unix(seconds, 0)
+	case strings.HasPrefix(line, "deepen-not "):
+		ref := strings.TrimPrefix(line, "deepen-not ")
+		commit, err := u.repo.ResolveRevision(ref)
+		if err == nil {
+			commit, err = u.repo.Peel(commit, "commit")
+		}
+		if err != nil {
+			return true, fmt.Errorf("ambiguous deepen-not: %s", ref)
+		}
+		u.deepenNot = append(u.deepenNot, commit)
+	case strings.HasPrefix(line, "filter "):
+		filter, err := transport.ParseFilter(strings.TrimPrefix(line, "filter "))
+		if err != nil {
+			return true, protocolError("%v", err)
+		}
+		u.filter = filter
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// checkWants makes sure the client only wants advertised tips or, when
+// allowReachable or uploadpack.allowReachableSHA1InWant is set, objects
+// reachable from them. uploadpack.allowAnySHA1InWant lets it want any
+// object here.
+func (u *upload) checkWants(allowReachable bool) error {
+	config, err := u.repo.Config()
+	if err != nil {
+		return err
+	}
+	if config.Bool("uploadpack", "", "allowAnySHA1InWant") {
+		return nil
+	}
+	refs, err := listRefs(u.repo)
+	if err != nil {
+		return err
+	}
+	tips := []string{}
+	isTip := map[string]bool{}
+	for _, ref := range refs {
+		tips = append(tips, ref.Hash)
+		isTip[ref.Hash] = true
+		if ref.Peeled != "" {
+			isTip[ref.Peeled] = true
+		}
+	}
+	others := []string{}
+	for _, want := range u.wants {
+		if !isTip[want] {
+			others = append(others, want)
+		}
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	if allowReachable || config.Bool("uploadpack", "", "allowReachableSHA1InWant") {
+		if others, err = u.repo.Unreachable(others, tips); err != nil {
+			return err
+		}
+		if len(others) == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %s", ErrNotOurRef, others[0])
+}
+
+// addHave records a have line and reports whether it named an object that
+// is here and was not offered before.
+func (u *upload) addHave(objectName string) bool {
+	if u.isCommon[objectName] || !object.IsName(objectName) || !u.repo.Objects.Has(objectName) {
+		return false
+	}
+	u.isCommon[objectName] = true
+	u.common = append(u.common, objectName)
+	return true
+}
+
+// okToGiveUp reports whether every wanted commit has a common commit in
+// its history, so that the client may stop sending haves, as git's
+// ok_to_give_up decides. Once true, it stays true.
+func (u *upload) okToGiveUp() (bool, error) {
+	if u.ready || len(u.common) == u.readyChecked {
+		return u.ready, nil
+	}
+	u.readyChecked = len(u.common)
+	common := []string{}
+	for _, have := range u.common {
+		if commit, err := u.repo.Peel(have, "commit"); err == nil {
+			common = append(common, commit)
+		}
+	}
+	wants := []string{}
+	for _, want := range u.wants {
+		if commit, err := u.repo.Peel(want, "commit"); err == nil {
+			wants = append(wants, commit)
+		}
+	}
+	if len(common) == 0 {
+		return false, nil
+	}
+	ready, err := u.repo.AllReach(wants, common)
+	u.ready = ready
+	return ready, err
+}
+
+// deepens reports whether the client asked for a shallow history.
+func (u *upload) deepens() bool {
+	return u.depth > 0 || !u.deepenSince.IsZero() || len(u.deepenNot) > 0
+}
+
+// deepen works out where the history sent to a shallow client stops, and
+// returns the commits the client is to record as shallow and those it no
+// longer should. The parents of unshallowed commits are sent along with
+// the wants.
+func (u *upload) deepen() ([]string, []string, error) {
+	u.boundary = u.clientShallow
+	if !u.deepens() {
+		return nil, nil, nil
+	}
+	if u.depth > 0 && (!u.deepenSince.IsZero() || len(u.deepenNot) > 0) {
+		return nil, nil, protocolError("deepen and deepen-since (or deepen-not) cannot be used together")
+	}
+
+	wants := []string{}
+	for _, want := range u.wants {
+		if commit, err := u.repo.Peel(want, "commit"); err == nil {
+			wants = append(wants, commit)
+		}
+	}
+	var boundary []string
+	var reached map[string]bool
+	var err error
+	switch {
+	case u.depth > 0 && u.deepenRelative:
+		// The shallow commits are the first generation, so depth more
+		// generations lie below them.
+		boundary, reached, err = u.repo.DeepenBoundary(u.clientShallow, u.depth+1)
+	case u.depth > 0:
+		boundary, reached, err = u.repo.DeepenBoundary(wants, u.depth)
+	default:
+		boundary, reached, err = u.repo.DeepenRevList(wants, u.deepenSince, u.deepenNot)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	isBoundary := map[string]bool{}
+	for _, commit := range boundary {
+		isBoundary[commit] = true
+	}
+	isClientShallow := map[string]bool{}
+	for _, commit := range u.clientShallow {
+		isClientShallow[commit] = true
+	}
+
+	shallow := []string{}
+	for _, commit := range boundary {
+		if !isClientShallow[commit] {
+			shallow = append(shallow, commit)
+		}
+	}
+	unshallow := []string{}
+	u.boundary = boundary
+	for _, commit := range u.clientShallow {
+		if !reached[commit] || isBoundary[commit] {
+			u.boundary = append(u.boundary, commit)
+			continue
+		}
+		unshallow = append(unshallow, commit)
+		parents, err := u.repo.Parents(commit)
+		if err != nil {
+			return nil, nil, err
+		}
+		u.include = append(u.include, parents...)
+	}
+	return shallow, unshallow, nil
+}
+
+// sendPack writes a pack of everything the client needs on side-band
+// channel 1, with progress on channel 2 when progress is set, and the
+// flush that ends the stream. With maxData 0 the pack is written as is.
+func (u *upload) sendPack(writer io.Writer, maxData int, progress bool) error {
+	var data, progressOutput io.Writer = writer, nil
+	if maxData > 0 {
+		data = newSideBandWriter(writer, 1, maxData)
+		if progress {
+			progressOutput = newSideBandWriter(writer, 2, maxData)
+		}
+	}
+
+	include := append(append([]string{}, u.wants...), u.include...)
+	objects, err := u.repo.ShallowReachableObjects(include, u.common, u.clientShallow, u.boundary, u.filter)
+	if err == nil && u.includeTag {
+		objects, err = u.addTags(objects)
+	}
+	if err == nil {
+		options := packfile.DefaultPackOptions()
+		options.OffsetDeltas = u.offsetDeltas
+		_, err = packfile.WriteObjects(data, objects, u.repo.Objects, options, progressOutput)
+	}
+	if maxData == 0 {
+		return err
+	}
+	if err != nil {
+		newSideBandWriter(writer, 3, maxData).Write([]byte(fmt.Sprintf("upload-pack: %v\n", err)))
+		return err
+	}
+	_, err = io.WriteString(writer, pktline.FLUSH)
+	return err
+}
+
+// addTags appends the annotated tags under refs/tags whose target is in
+// objects, as include-tag asks.
+func (u *upload) addTags(objects []packfile.PackObject) ([]packfile.PackObject, error) {
+	inPack := map[string]bool{}
+	for _, packObject := range objects {
+		inPack[packObject.Name] = true
+	}
+	refs, err := listRefs(u.repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.Name, "refs/tags/") && ref.Peeled != "" && inPack[ref.Peeled] && !inPack[ref.Hash] && !u.isCommon[ref.Hash] {
+			inPack[ref.Hash] = true
+			objects = append(objects, packfile.PackObject{Name: ref.Hash})
+		}
+	}
+	return objects, nil
+}
+
+// uploadCapabilities lists the capabilities upload-pack advertises in
+// protocol v0. Clients only ask for objects other than the tips when the
+// config allows it.
+func uploadCapabilities(refs []advertisedRef, config *repository.Config) string {
+	capabilities := "multi_ack thin-pack side-band side-band-64k ofs-delta shallow deepen-since deepen-not deepen-relative no-progress include-tag multi_ack_detailed filter"
+	if config.Bool("uploadpack", "", "allowAnySHA1InWant") {
+		capabilities += " allow-tip-sha1-in-want allow-reachable-sha1-in-want"
+	} else if config.Bool("uploadpack", "", "allowReachableSHA1InWant") {
+		capabilities += " allow-reachable-sha1-in-want"
+	}
+	if len(refs) > 0 && refs[0].Name == "HEAD" && refs[0].Target != "" {
+		capabilities += " symref=HEAD:" + refs[0].Target
+	}
+	return capabilities + " object-format=sha1 agent=" + transport.AGENT
+}
+
+// UploadPack serves a fetch of repo: the client's requests are read from
+// reader and the responses written to writer. Protocol v0 and v2 are
+// supported.
+func UploadPack(repo *repository.Repository, reader io.Reader, writer io.Writer, options Options) error {
+	if options.Version == 2 {
+		return uploadPackV2(repo, reader, writer, options)
+	}
+
+	output := bufio.NewWriter(writer)
+	if options.AdvertiseRefs || !options.StatelessRPC {
+		refs, err := listRefs(repo)
+		if err != nil {
+			return err
+		}
+		config, err := repo.Config()
+		if err != nil {
+			return err
+		}
+		if err := writeAdvertisement(writer, refs, uploadCapabilities(refs, config)); err != nil {
+			return err
+		}
+		if options.AdvertiseRefs {
+			return nil
+		}
+	}
+
+	// The first want carries the capabilities the client chose.
+	upload := newUpload(repo)
+	capabilities := transport.Capabilities{}
+	for {
+		special, line, err := readLine(reader)
+		if errors.Is(err, io.EOF) && len(upload.wants) == 0 {
+			// The client only wanted the advertisement.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if special == pktline.FLUSH {
+			break
+		}
+		if len(upload.wants) == 0 && strings.HasPrefix(line, "want ") {
+			if fields := strings.SplitN(line, " ", 3); len(fields) == 3 {
+				capabilities = transport.ParseCapabilities(fields[2])
+			}
+		}
+		ok, err := upload.parseArgument(line)
+		if err == nil && !ok {
+			err = protocolError("expected want, got %q", line)
+		}
+		if err != nil {
+			writePacket(output, fmt.Sprintf("ERR upload-pack: %v\n", err))
+			output.Flush()
+			return err
+		}
+	}
+	if len(upload.wants) == 0 {
+		return output.Flush()
+	}
+	if err := upload.checkWants(false); err != nil {
+		writePacket(output, fmt.Sprintf("ERR upload-pack: %v\n", err))
+		output.Flush()
+		return err
+	}
+	upload.includeTag = capabilities.Has("include-tag")
+	upload.deepenRelative = capabilities.Has("deepen-relative")
+	upload.offsetDeltas = capabilities.Has("ofs-delta")
+
+	shallow, unshallow, err := upload.deepen()
+	if err != nil {
+		writePacket(output, fmt.Sprintf("ERR upload-pack: %v\n", err))
+		output.Flush()
+		return err
+	}
+	if upload.deepens() {
+		for _, commit := range shallow {
+			writePacket(output, fmt.Sprintf("shallow %s\n", commit))
+		}
+		for _, commit := range unshallow {
+			writePacket(output, fmt.Sprintf("unshallow %s\n", commit))
+		}
+		io.WriteString(output, pktline.FLUSH)
+		// A client on a stream waits for the boundary before sending
+		// its haves.
+		if err := output.Flush(); err != nil {
+			return err
+		}
+	}
+
+	done, err := upload.negotiate(reader, output, capabilities, options.StatelessRPC)
+	if err != nil || !done {
+		if flushErr := output.Flush(); err == nil {
+			err = flushErr
+		}
+		return err
+	}
+
+	maxData := 0
+	if capabilities.Has("side-band-64k") {
+		maxData = MAX_SIDE_BAND_64K_DATA
+	} else if capabilities.Has("side-band") {
+		maxData = MAX_SIDE_BAND_DATA
+	}
+	if err := upload.sendPack(output, maxData, !capabilities.Has("no-progress")); err != nil {
+		output.Flush()
+		return err
+	}
+	return output.Flush()
+}
+
+// negotiate reads the client's haves and acknowledges them the way git's
+// upload-pack does for multi_ack_detailed, multi_ack and plain clients,
+// ending each round at a flush. Once the common commits cover the wants,
+// a multi_ack_detailed client is told the server is ready. It reports
+// whether the client sent done; a stateless exchange stops after one round.
+func (u *upload) negotiate(reader io.Reader, output *bufio.Writer, capabilities transport.Capabilities, stateless bool) (bool, error) {
+	multiAck := 0
+	if capabilities.Has("multi_ack_detailed") {
+		multiAck = 2
+	} else if capabilities.Has("multi_ack") {
+		multiAck = 1
+	}
+
+	// gotCommon and gotOther record whether this round had haves that are
+	// here and haves that are not.
+	gotCommon, gotOther := false, false
+	for {
+		special, line, err := readLine(reader)
+		if errors.Is(err, io.EOF) && stateless {
+			// A deepening client asks for the shallow boundary alone
+			// before it negotiates.
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case special == pktline.FLUSH:
+			if multiAck == 2 && gotCommon && !gotOther {
+				ready, err := u.okToGiveUp()
+				if err != nil {
+					return false, err
+				}
+				if ready {
+					writePacket(output, fmt.Sprintf("ACK %s ready\n", u.common[len(u.common)-1]))
+				}
+			}
+			if len(u.common) == 0 || multiAck > 0 {
+				writePacket(output, "NAK\n")
+			}
+			if err := output.Flush(); err != nil {
+				return false, err
+			}
+			if stateless {
+				return false, nil
+			}
+			gotCommon, gotOther = false, false
+
+		case line == "done":
+			if len(u.common) == 0 {
+				writePacket(output, "NAK\n")
+			} else if multiAck > 0 {
+				writePacket(output, fmt.Sprintf("ACK %s\n", u.common[len(u.common)-1]))
+			}
+			return true, nil
+
+		case strings.HasPrefix(line, "have "):
+			have := strings.TrimPrefix(line, "have ")
+			if u.isCommon[have] {
+				continue
+			}
+			if !u.addHave(have) {
+				gotOther = true
+				if multiAck == 0 {
+					continue
+				}
+				ready, err := u.okToGiveUp()
+				if err != nil {
+					return false, err
+				}
+				if ready && multiAck == 2 {
+					writePacket(output, fmt.Sprintf("ACK %s ready\n", have))
+				} else if ready {
+					writePacket(output, fmt.Sprintf("ACK %s continue\n", have))
+				}
+				continue
+			}
+			gotCommon = true
+			switch {
+			case multiAck == 2:
+				writePacket(output, fmt.Sprintf("ACK %s common\n", have))
+			case multiAck == 1:
+				writePacket(output, fmt.Sprintf("ACK %s continue\n", have))
+			case len(u.common) == 1:
+				writePacket(output, fmt.Sprintf("ACK %s\n", have))
+			}
+
+		default:
+			return false, protocolError("expected have or done, got %q", line)
+		}
+	}
+}
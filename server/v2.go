@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/repository"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// v2Capabilities are advertised after "version 2", one per line.
+var v2Capabilities = []string{
+	"agent=" + transport.AGENT,
+	"ls-refs=unborn",
+	"fetch=shallow filter",
+	"object-format=sha1",
+}
+
+// uploadPackV2 advertises the protocol v2 capabilities and serves
+// commands until the client hangs up, or serves a single command in a
+// stateless exchange.
+func uploadPackV2(repo *repository.Repository, reader io.Reader, writer io.Writer, options Options) error {
+	output := bufio.NewWriter(writer)
+	if options.AdvertiseRefs || !options.StatelessRPC {
+		writePacket(output, "version 2\n")
+		for _, capability := range v2Capabilities {
+			writePacket(output, capability+"\n")
+		}
+		io.WriteString(output, pktline.FLUSH)
+		if err := output.Flush(); err != nil || options.AdvertiseRefs {
+			return err
+		}
+	}
+
+	for {
+		command, arguments, err := readCommand(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "ls-refs":
+			err = lsRefs(repo, arguments, output)
+		case "fetch":
+			err = fetch(repo, arguments, output)
+		default:
+			err = protocolError("unknown command %q", command)
+		}
+		if err != nil {
+			writePacket(output, fmt.Sprintf("ERR upload-pack: %v\n", err))
+			output.Flush()
+			return err
+		}
+		if err := output.Flush(); err != nil || options.StatelessRPC {
+			return err
+		}
+	}
+}
+
+// readCommand reads a "command=<name>" request with its capabilities, up
+// to the delimiter, and its arguments, up to the flush. It returns io.EOF
+// when the client ends the session.
+func readCommand(reader io.Reader) (string, []string, error) {
+	special, line, err := readLine(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	if special == pktline.FLUSH {
+		return "", nil, io.EOF
+	}
+	command, ok := strings.CutPrefix(line, "command=")
+	if !ok {
+		return "", nil, protocolError("expected a command, got %q", line)
+	}
+
+	for special == "" {
+		special, line, err = readLine(reader)
+		if err != nil {
+			return "", nil, err
+		}
+		if special == "" && strings.HasPrefix(line, "object-format=") && line != "object-format=sha1" {
+			return "", nil, fmt.Errorf("%w: %s", transport.ErrUnsupportedObjectFormat, strings.TrimPrefix(line, "object-format="))
+		}
+	}
+	arguments := []string{}
+	for special == pktline.DELIM {
+		special, line, err = readLine(reader)
+		if err != nil {
+			return "", nil, err
+		}
+		if special == "" {
+			arguments = append(arguments, line)
+			special = pktline.DELIM
+		}
+	}
+	return command, arguments, nil
+}
+
+// lsRefs answers the ls-refs command: the refs matching any ref-prefix
+// argument, with symref targets and peeled tags when asked for.
+func lsRefs(repo *repository.Repository, arguments []string, output io.Writer) error {
+	symrefs, peel, unborn := false, false, false
+	prefixes := []string{}
+	for _, argument := range arguments {
+		switch {
+		case argument == "symrefs":
+			symrefs = true
+		case argument == "peel":
+			peel = true
+		case argument == "unborn":
+			unborn = true
+		case strings.HasPrefix(argument, "ref-prefix "):
+			prefixes = append(prefixes, strings.TrimPrefix(argument, "ref-prefix "))
+		default:
+			return protocolError("unexpected ls-refs argument %q", argument)
+		}
+	}
+	matches := func(name string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return len(prefixes) == 0
+	}
+
+	refs, err := listRefs(repo)
+	if err != nil {
+		return err
+	}
+	if unborn && matches("HEAD") && (len(refs) == 0 || refs[0].Name != "HEAD") {
+		if target, ok, err := repo.ReadSymbolicRef("HEAD"); err != nil {
+			return err
+		} else if ok {
+			line := "unborn HEAD"
+			if symrefs {
+				line += " symref-target:" + target
+			}
+			writePacket(output, line+"\n")
+		}
+	}
+	for _, ref := range refs {
+		if !matches(ref.Name) {
+			continue
+		}
+		line := fmt.Sprintf("%s %s", ref.Hash, ref.Name)
+		if symrefs && ref.Target != "" {
+			line += " symref-target:" + ref.Target
+		}
+		if peel && ref.Peeled != "" {
+			line += " peeled:" + ref.Peeled
+		}
+		writePacket(output, line+"\n")
+	}
+	_, err = io.WriteString(output, pktline.FLUSH)
+	return err
+}
+
+// fetch answers the fetch command. Until the client sends done, it only
+// acknowledges the haves, until the common commits cover the wants and it
+// declares itself ready; then it sends the shallow-info of a deepening
+// request and the pack.
+func fetch(repo *repository.Repository, arguments []string, output io.Writer) error {
+	upload := newUpload(repo)
+	done, progress := false, true
+	for _, argument := range arguments {
+		ok, err := upload.parseArgument(argument)
+		if err != nil {
+			return err
+		}
+		switch {
+		case ok:
+		case strings.HasPrefix(argument, "have "):
+			upload.addHave(strings.TrimPrefix(argument, "have "))
+		case argument == "done":
+			done = true
+		case argument == "no-progress":
+			progress = false
+		case argument == "include-tag":
+			upload.includeTag = true
+		case argument == "ofs-delta":
+			upload.offsetDeltas = true
+		case argument == "thin-pack":
+		default:
+			return protocolError("unexpected fetch argument %q", argument)
+		}
+	}
+	// Wants in protocol v2 are not limited to advertised tips; a partial
+	// clone asks for the blobs it is missing.
+	if err := upload.checkWants(true); err != nil {
+		return err
+	}
+
+	if !done {
+		writePacket(output, "acknowledgments\n")
+		if len(upload.common) == 0 {
+			writePacket(output, "NAK\n")
+		}
+		for _, have := range upload.common {
+			writePacket(output, fmt.Sprintf("ACK %s\n", have))
+		}
+		ready, err := upload.okToGiveUp()
+		if err != nil {
+			return err
+		}
+		if !ready {
+			_, err := io.WriteString(output, pktline.FLUSH)
+			return err
+		}
+		writePacket(output, "ready\n")
+		io.WriteString(output, pktline.DELIM)
+	}
+
+	shallow, unshallow, err := upload.deepen()
+	if err != nil {
+		return err
+	}
+	if upload.deepens() {
+		writePacket(output, "shallow-info\n")
+		for _, commit := range shallow {
+			writePacket(output, fmt.Sprintf("shallow %s\n", commit))
+		}
+		for _, commit := range unshallow {
+			writePacket(output, fmt.Sprintf("unshallow %s\n", commit))
+		}
+		io.WriteString(output, pktline.DELIM)
+	}
+	writePacket(output, "packfile\n")
+	return upload.sendPack(output, MAX_SIDE_BAND_64K_DATA, progress)
+}
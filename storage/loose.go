@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+type LooseObjectStore struct {
+	basePath string
+}
+
+func NewLooseObjectStore(basePath string) *LooseObjectStore {
+	return &LooseObjectStore{basePath: basePath}
+}
+
+func (s *LooseObjectStore) path(objectName string) string {
+	return filepath.Join(s.basePath, "objects", objectName[:2], objectName[2:])
+}
+
+func (s *LooseObjectStore) Has(objectName string) bool {
+	if !object.IsName(objectName) {
+		return false
+	}
+	_, err := os.Stat(s.path(objectName))
+	return err == nil
+}
+
+func (s *LooseObjectStore) open(objectName string) (io.ReadCloser, string, int, error) {
+	if !object.IsName(objectName) {
+		return nil, "", 0, object.InvalidName(objectName)
+	}
+	file, err := os.Open(s.path(objectName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", 0, object.NotFound(objectName)
+	}
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("unable to open file: %v", err)
+	}
+
+	reader, err := zlib.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, "", 0, object.Corrupt(objectName, err.Error())
+	}
+
+	header := []byte{}
+	for {
+		b := []byte{0}
+		if _, err := io.ReadFull(reader, b); err != nil {
+			file.Close()
+			return nil, "", 0, object.Corrupt(objectName, err.Error())
+		}
+		if b[0] == 0 {
+			break
+		}
+		header = append(header, b[0])
+	}
+
+	var objectType string
+	var size int
+	if _, err := fmt.Sscanf(string(header), "%s %d", &objectType, &size); err != nil {
+		file.Close()
+		return nil, "", 0, object.Corrupt(objectName, "bad object header")
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, objectType, size, nil
+}
+
+func (s *LooseObjectStore) Read(objectName string) ([]byte, string, error) {
+	reader, objectType, size, err := s.open(objectName)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", object.Corrupt(objectName, err.Error())
+	}
+	if size != len(data) {
+		return nil, "", object.Corrupt(objectName, "bad object size")
+	}
+	return data, objectType, nil
+}
+
+func (s *LooseObjectStore) Stat(objectName string) (string, int, error) {
+	reader, objectType, size, err := s.open(objectName)
+	if err != nil {
+		return "", 0, err
+	}
+	reader.Close()
+	return objectType, size, nil
+}
+
+func (s *LooseObjectStore) diskInfo(objectName string) (int64, string, error) {
+	if !object.IsName(objectName) {
+		return 0, "", object.InvalidName(objectName)
+	}
+	info, err := os.Stat(s.path(objectName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, "", object.NotFound(objectName)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return info.Size(), "", nil
+}
+
+func (s *LooseObjectStore) Write(objectType string, data []byte) ([]byte, error) {
+	shaRaw := object.Hash(objectType, data)
+	sha1Hash := hex.EncodeToString(shaRaw)
+	if s.Has(sha1Hash) {
+		return shaRaw, nil
+	}
+
+	outputPath := s.path(sha1Hash)
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create object directory: %v", err)
+	}
+
+	// Compress and write the object to file
+	var buf bytes.Buffer
+	compressor := zlib.NewWriter(&buf)
+	fmt.Fprintf(compressor, "%s %d", objectType, len(data))
+	compressor.Write([]byte{0})
+	_, err := compressor.Write(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write to zlib: %v", err)
+	}
+	compressor.Close()
+
+	if err := os.WriteFile(outputPath, buf.Bytes(), 0444); err != nil {
+		return nil, fmt.Errorf("failed to write compressed content to file: %v", err)
+	}
+	return shaRaw, nil
+}
+
+func (s *LooseObjectStore) Iterate(fn func(objectName string) error) error {
+	dirs, err := filepath.Glob(filepath.Join(s.basePath, "objects", "[0-9a-f][0-9a-f]"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			objectName := filepath.Base(dir) + file.Name()
+			if !object.IsName(objectName) {
+				continue
+			}
+			if err := fn(objectName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
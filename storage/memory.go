@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+type memoryObject struct {
+	objectType string
+	data       []byte
+}
+
+// MemoryObjectStore keeps objects in a map and never touches disk.
+type MemoryObjectStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemoryObjectStore() *MemoryObjectStore {
+	return &MemoryObjectStore{objects: map[string]memoryObject{}}
+}
+
+func (s *MemoryObjectStore) Has(objectName string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.objects[objectName]
+	return ok
+}
+
+func (s *MemoryObjectStore) Read(objectName string) ([]byte, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.objects[objectName]
+	if !ok {
+		return nil, "", object.NotFound(objectName)
+	}
+	return entry.data, entry.objectType, nil
+}
+
+func (s *MemoryObjectStore) Stat(objectName string) (string, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.objects[objectName]
+	if !ok {
+		return "", 0, object.NotFound(objectName)
+	}
+	return entry.objectType, len(entry.data), nil
+}
+
+func (s *MemoryObjectStore) Write(objectType string, data []byte) ([]byte, error) {
+	shaRaw := object.Hash(objectType, data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[hex.EncodeToString(shaRaw)] = memoryObject{objectType: objectType, data: bytes.Clone(data)}
+	return shaRaw, nil
+}
+
+func (s *MemoryObjectStore) Iterate(fn func(objectName string) error) error {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.objects))
+	for objectName := range s.objects {
+		names = append(names, objectName)
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(names)
+	for _, objectName := range names {
+		if err := fn(objectName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/packfile"
+)
+
+// PackObjectStore serves objects from every pack-*.idx/pack-*.pack pair in
+// the objects/pack directory. The directory is rescanned when a lookup
+// misses and its modification time has changed since the last scan, so
+// packs written after the store was created are picked up.
+type PackObjectStore struct {
+	dir string
+	// bases resolves REF_DELTA bases that are not in the same pack.
+	bases ObjectStore
+
+	mu      sync.Mutex
+	packs   []*packfile.Packfile
+	loaded  bool
+	modTime time.Time
+}
+
+func NewPackObjectStore(basePath string, bases ObjectStore) *PackObjectStore {
+	return &PackObjectStore{dir: filepath.Join(basePath, "objects", "pack"), bases: bases}
+}
+
+func (s *PackObjectStore) load() ([]*packfile.Packfile, error) {
+	dir := s.dir
+	// The directory is statted before it is read, so that a pack added
+	// while reading it changes the time again and is found next time.
+	var modTime time.Time
+	if info, err := os.Stat(dir); err == nil {
+		modTime = info.ModTime()
+	}
+	indexPaths, err := filepath.Glob(filepath.Join(dir, "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	opened := map[string]*packfile.Packfile{}
+	for _, pack := range s.packs {
+		opened[pack.Path()] = pack
+	}
+
+	packs := []*packfile.Packfile{}
+	for _, indexPath := range indexPaths {
+		pack, ok := opened[indexPath]
+		if !ok {
+			pack, err = packfile.Open(indexPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		delete(opened, indexPath)
+		packs = append(packs, pack)
+	}
+	for _, pack := range opened {
+		pack.Close()
+	}
+	s.packs = packs
+	s.loaded = true
+	s.modTime = modTime
+	return packs, nil
+}
+
+// reload rescans the pack directory if it has changed since the last scan.
+func (s *PackObjectStore) reload() ([]*packfile.Packfile, bool, error) {
+	var modTime time.Time
+	if info, err := os.Stat(s.dir); err == nil {
+		modTime = info.ModTime()
+	}
+	s.mu.Lock()
+	packs, unchanged := s.packs, s.loaded && s.modTime.Equal(modTime)
+	s.mu.Unlock()
+	if unchanged {
+		return packs, false, nil
+	}
+	packs, err := s.load()
+	return packs, true, err
+}
+
+// close closes the packs the store has opened.
+func (s *PackObjectStore) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pack := range s.packs {
+		pack.Close()
+	}
+	s.packs, s.loaded = nil, false
+}
+
+func (s *PackObjectStore) list() ([]*packfile.Packfile, error) {
+	s.mu.Lock()
+	packs, loaded := s.packs, s.loaded
+	s.mu.Unlock()
+	if loaded {
+		return packs, nil
+	}
+	return s.load()
+}
+
+func (s *PackObjectStore) find(objectName string) (*packfile.Packfile, uint64, error) {
+	name, err := hex.DecodeString(objectName)
+	if err != nil || len(name) != object.SHA1_HASH_LENGTH {
+		return nil, 0, object.InvalidName(objectName)
+	}
+
+	packs, err := s.list()
+	for attempt := 0; err == nil && attempt < 2; attempt++ {
+		for _, pack := range packs {
+			if offset, ok := pack.FindOffset(name); ok {
+				return pack, offset, nil
+			}
+		}
+		var changed bool
+		packs, changed, err = s.reload()
+		if !changed {
+			break
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return nil, 0, object.NotFound(objectName)
+}
+
+func (s *PackObjectStore) Has(objectName string) bool {
+	_, _, err := s.find(objectName)
+	return err == nil
+}
+
+func (s *PackObjectStore) Read(objectName string) ([]byte, string, error) {
+	pack, offset, err := s.find(objectName)
+	if err != nil {
+		return nil, "", err
+	}
+	return pack.ReadObjectAt(offset, s.bases)
+}
+
+func (s *PackObjectStore) Stat(objectName string) (string, int, error) {
+	pack, offset, err := s.find(objectName)
+	if err != nil {
+		return "", 0, err
+	}
+	return pack.StatAt(offset, s.bases)
+}
+
+func (s *PackObjectStore) diskInfo(objectName string) (int64, string, error) {
+	pack, offset, err := s.find(objectName)
+	if err != nil {
+		return 0, "", err
+	}
+	return pack.DiskInfo(offset)
+}
+
+func (s *PackObjectStore) Write(objectType string, data []byte) ([]byte, error) {
+	return nil, ErrReadOnly
+}
+
+func (s *PackObjectStore) Iterate(fn func(objectName string) error) error {
+	packs, err := s.list()
+	if err != nil {
+		return err
+	}
+	for _, pack := range packs {
+		for i := 0; i < pack.NumObjects(); i++ {
+			if err := fn(pack.ObjectName(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MarkPromisor records that a pack came from a promisor remote, so objects
+// it references but does not contain are expected to be missing.
+func MarkPromisor(basePath string, packName string) error {
+	path := filepath.Join(basePath, "objects", "pack", fmt.Sprintf("pack-%s.promisor", packName))
+	return os.WriteFile(path, []byte{}, 0444)
+}
+
+// StorePackfile writes the pack read from reader into
+// basePath/objects/pack and indexes it, returning the pack name. Delta
+// bases missing from a thin pack are copied in from bases. Progress meters
+// are drawn on progress unless it is nil.
+func StorePackfile(basePath string, reader io.Reader, bases ObjectStore, progress io.Writer) (string, error) {
+	dir := filepath.Join(basePath, "objects", "pack")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create pack directory: %v", err)
+	}
+	return packfile.WritePack(reader, dir, bases, progress)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// prefixFinder is implemented by stores that can find abbreviated names
+// without iterating over every object.
+type prefixFinder interface {
+	findPrefix(prefix string, fn func(objectName string)) error
+}
+
+// FindPrefix returns the sorted names of all objects in store whose hex
+// name starts with prefix.
+func FindPrefix(store ObjectStore, prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	found := map[string]bool{}
+	add := func(objectName string) {
+		if strings.HasPrefix(objectName, prefix) {
+			found[objectName] = true
+		}
+	}
+
+	var err error
+	if finder, ok := store.(prefixFinder); ok {
+		err = finder.findPrefix(prefix, add)
+	} else {
+		err = store.Iterate(func(objectName string) error {
+			add(objectName)
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(found))
+	for objectName := range found {
+		names = append(names, objectName)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *CombinedObjectStore) findPrefix(prefix string, fn func(objectName string)) error {
+	for _, store := range s.stores {
+		names, err := FindPrefix(store, prefix)
+		if err != nil {
+			return err
+		}
+		for _, objectName := range names {
+			fn(objectName)
+		}
+	}
+	return nil
+}
+
+func (s *LooseObjectStore) findPrefix(prefix string, fn func(objectName string)) error {
+	if len(prefix) < 2 {
+		return s.Iterate(func(objectName string) error {
+			fn(objectName)
+			return nil
+		})
+	}
+
+	files, err := os.ReadDir(filepath.Join(s.basePath, "objects", prefix[:2]))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fn(prefix[:2] + file.Name())
+	}
+	return nil
+}
+
+func (s *PackObjectStore) findPrefix(prefix string, fn func(objectName string)) error {
+	packs, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	var first []byte
+	if len(prefix) >= 2 {
+		first, _ = hex.DecodeString(prefix[:2])
+	}
+	for _, pack := range packs {
+		lo, hi := 0, pack.NumObjects()
+		if len(first) == 1 {
+			lo, hi = pack.FanoutRange(first[0])
+		}
+		i := lo + sort.Search(hi-lo, func(i int) bool { return pack.ObjectName(lo+i) >= prefix })
+		for ; i < hi && strings.HasPrefix(pack.ObjectName(i), prefix); i++ {
+			fn(pack.ObjectName(i))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// Prefetcher is implemented by stores that can download several missing
+// objects in one request.
+type Prefetcher interface {
+	Prefetch(objectNames []string) error
+}
+
+// PromisorObjectStore serves a partial clone. Objects missing from the
+// local store are fetched from the promisor remote with fetch and then read
+// again. Has and Iterate only look at local objects.
+type PromisorObjectStore struct {
+	ObjectStore
+	fetch func(objectNames []string) error
+}
+
+func NewPromisorObjectStore(local ObjectStore, fetch func(objectNames []string) error) *PromisorObjectStore {
+	return &PromisorObjectStore{ObjectStore: local, fetch: fetch}
+}
+
+func (s *PromisorObjectStore) Read(objectName string) ([]byte, string, error) {
+	data, objectType, err := s.ObjectStore.Read(objectName)
+	if !errors.Is(err, object.ErrObjectNotFound) || !object.IsName(objectName) {
+		return data, objectType, err
+	}
+	if err := s.fetch([]string{objectName}); err != nil {
+		return nil, "", err
+	}
+	return s.ObjectStore.Read(objectName)
+}
+
+func (s *PromisorObjectStore) Stat(objectName string) (string, int, error) {
+	objectType, size, err := s.ObjectStore.Stat(objectName)
+	if !errors.Is(err, object.ErrObjectNotFound) || !object.IsName(objectName) {
+		return objectType, size, err
+	}
+	if err := s.fetch([]string{objectName}); err != nil {
+		return "", 0, err
+	}
+	return s.ObjectStore.Stat(objectName)
+}
+
+// Prefetch fetches every object in objectNames that is not present locally
+// in a single request.
+func (s *PromisorObjectStore) Prefetch(objectNames []string) error {
+	missing := []string{}
+	for _, objectName := range objectNames {
+		if !s.Has(objectName) {
+			missing = append(missing, objectName)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return s.fetch(missing)
+}
+
+func (s *PromisorObjectStore) diskInfo(objectName string) (int64, string, error) {
+	return DiskInfo(s.ObjectStore, objectName)
+}
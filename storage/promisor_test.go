@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/hex"
+	"slices"
+	"testing"
+)
+
+// newTestPromisor returns a promisor store over an empty local store whose
+// fetches copy objects from remote, and the batches it fetched.
+func newTestPromisor(remote ObjectStore) (*PromisorObjectStore, *[][]string) {
+	fetches := [][]string{}
+	local := NewMemoryObjectStore()
+	store := NewPromisorObjectStore(local, func(objectNames []string) error {
+		fetches = append(fetches, objectNames)
+		for _, objectName := range objectNames {
+			data, objectType, err := remote.Read(objectName)
+			if err != nil {
+				return err
+			}
+			if _, err := local.Write(objectType, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return store, &fetches
+}
+
+func writeTestBlobs(t *testing.T, store ObjectStore, contents ...string) []string {
+	t.Helper()
+	names := []string{}
+	for _, content := range contents {
+		name, err := store.Write("blob", []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hex.EncodeToString(name))
+	}
+	return names
+}
+
+func TestPromisorReadFetchesMissingObject(t *testing.T) {
+	remote := NewMemoryObjectStore()
+	names := writeTestBlobs(t, remote, "lazy")
+	store, fetches := newTestPromisor(remote)
+
+	for range 2 {
+		data, objectType, err := store.Read(names[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if objectType != "blob" || string(data) != "lazy" {
+			t.Fatalf("read %s %q, want blob \"lazy\"", objectType, data)
+		}
+	}
+	if len(*fetches) != 1 {
+		t.Errorf("fetched %d times, want once", len(*fetches))
+	}
+}
+
+func TestPromisorPrefetchBatchesMissingObjects(t *testing.T) {
+	remote := NewMemoryObjectStore()
+	names := writeTestBlobs(t, remote, "one", "two", "three")
+	store, fetches := newTestPromisor(remote)
+	writeTestBlobs(t, store, "one")
+
+	if err := store.Prefetch(names); err != nil {
+		t.Fatal(err)
+	}
+	if len(*fetches) != 1 || !slices.Equal((*fetches)[0], names[1:]) {
+		t.Fatalf("fetched %v, want one batch of %v", *fetches, names[1:])
+	}
+	if err := store.Prefetch(names); err != nil {
+		t.Fatal(err)
+	}
+	if len(*fetches) != 1 {
+		t.Errorf("fetched again with every object present: %v", *fetches)
+	}
+}
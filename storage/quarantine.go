@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/packfile"
+)
+
+// Quarantine keeps the packs received by a push apart from the repository
+// until its ref updates are accepted, like git's tmp_objdir. Objects reads
+// the repository and the quarantined packs together; Migrate moves the
+// packs into the repository and Remove throws them away.
+type Quarantine struct {
+	basePath string
+	dir      string
+	packs    *PackObjectStore
+	Objects  ObjectStore
+}
+
+// NewQuarantine creates an empty quarantine directory under the objects of
+// the git directory at basePath, whose object store is objects.
+func NewQuarantine(basePath string, objects ObjectStore) (*Quarantine, error) {
+	dir, err := os.MkdirTemp(filepath.Join(basePath, "objects"), "incoming-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %v", err)
+	}
+	packs := &PackObjectStore{dir: filepath.Join(dir, "pack")}
+	store := NewCombinedObjectStore(objects, packs)
+	packs.bases = store
+	return &Quarantine{basePath: basePath, dir: dir, packs: packs, Objects: store}, nil
+}
+
+// StorePackfile writes the pack read from reader into the quarantine, as
+// StorePackfile does into a repository.
+func (q *Quarantine) StorePackfile(reader io.Reader, progress io.Writer) (string, error) {
+	dir := filepath.Join(q.dir, "pack")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create pack directory: %v", err)
+	}
+	return packfile.WritePack(reader, dir, q.Objects, progress)
+}
+
+// Migrate moves the quarantined packs into the repository, each .pack
+// before its .idx so that a pack is complete once it can be found, and
+// removes the quarantine.
+func (q *Quarantine) Migrate() error {
+	q.packs.close()
+	dir := filepath.Join(q.basePath, "objects", "pack")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create pack directory: %v", err)
+	}
+	names, err := filepath.Glob(filepath.Join(q.dir, "pack", "pack-*"))
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return !strings.HasSuffix(names[i], ".idx") && strings.HasSuffix(names[j], ".idx")
+	})
+	for _, name := range names {
+		if err := os.Rename(name, filepath.Join(dir, filepath.Base(name))); err != nil {
+			return err
+		}
+	}
+	return q.Remove()
+}
+
+// Remove deletes the quarantine and whatever it still holds.
+func (q *Quarantine) Remove() error {
+	q.packs.close()
+	return os.RemoveAll(q.dir)
+}
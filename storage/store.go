@@ -0,0 +1,122 @@
+// Package storage provides the ObjectStore interface and its loose, packed,
+// combined and in-memory backends.
+package storage
+
+import (
+	"errors"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// ErrReadOnly is returned by Write on stores that cannot hold new objects.
+var ErrReadOnly = errors.New("object store is read-only")
+
+// ObjectStore is the single place objects are read from and written to.
+// Names are 40 character hex strings and payloads never include the
+// "<type> <size>\0" header.
+type ObjectStore interface {
+	Has(objectName string) bool
+	Read(objectName string) ([]byte, string, error)
+	Write(objectType string, data []byte) ([]byte, error)
+	Stat(objectName string) (string, int, error)
+	Iterate(fn func(objectName string) error) error
+}
+
+// NewRepositoryObjectStore reads loose objects first, then packs, from the
+// git directory at basePath. New objects are written loose.
+func NewRepositoryObjectStore(basePath string) ObjectStore {
+	loose := NewLooseObjectStore(basePath)
+	packed := NewPackObjectStore(basePath, nil)
+	store := NewCombinedObjectStore(loose, packed)
+	packed.bases = store
+	return store
+}
+
+// CombinedObjectStore looks objects up in each store in turn and writes to
+// the first one.
+type CombinedObjectStore struct {
+	stores []ObjectStore
+}
+
+func NewCombinedObjectStore(stores ...ObjectStore) *CombinedObjectStore {
+	return &CombinedObjectStore{stores: stores}
+}
+
+func (s *CombinedObjectStore) Has(objectName string) bool {
+	for _, store := range s.stores {
+		if store.Has(objectName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CombinedObjectStore) Read(objectName string) ([]byte, string, error) {
+	for _, store := range s.stores {
+		data, objectType, err := store.Read(objectName)
+		if !errors.Is(err, object.ErrObjectNotFound) {
+			return data, objectType, err
+		}
+	}
+	return nil, "", object.NotFound(objectName)
+}
+
+func (s *CombinedObjectStore) Stat(objectName string) (string, int, error) {
+	for _, store := range s.stores {
+		objectType, size, err := store.Stat(objectName)
+		if !errors.Is(err, object.ErrObjectNotFound) {
+			return objectType, size, err
+		}
+	}
+	return "", 0, object.NotFound(objectName)
+}
+
+func (s *CombinedObjectStore) Write(objectType string, data []byte) ([]byte, error) {
+	return s.stores[0].Write(objectType, data)
+}
+
+func (s *CombinedObjectStore) Iterate(fn func(objectName string) error) error {
+	seen := map[string]bool{}
+	for _, store := range s.stores {
+		err := store.Iterate(func(objectName string) error {
+			if seen[objectName] {
+				return nil
+			}
+			seen[objectName] = true
+			return fn(objectName)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diskInfoStore is implemented by stores that know how objects are laid
+// out on disk.
+type diskInfoStore interface {
+	diskInfo(objectName string) (int64, string, error)
+}
+
+// DiskInfo returns the number of bytes objectName takes up on disk and the
+// name of the object it is stored as a delta against, or "" if it is
+// stored whole. Stores that keep nothing on disk report a size of 0.
+func DiskInfo(store ObjectStore, objectName string) (int64, string, error) {
+	if store, ok := store.(diskInfoStore); ok {
+		return store.diskInfo(objectName)
+	}
+	if !store.Has(objectName) {
+		return 0, "", object.NotFound(objectName)
+	}
+	return 0, "", nil
+}
+
+func (s *CombinedObjectStore) diskInfo(objectName string) (int64, string, error) {
+	for _, store := range s.stores {
+		size, base, err := DiskInfo(store, objectName)
+		if !errors.Is(err, object.ErrObjectNotFound) {
+			return size, base, err
+		}
+	}
+	return 0, "", object.NotFound(objectName)
+}
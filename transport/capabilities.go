@@ -0,0 +1,50 @@
+package transport
+
+import "strings"
+
+// AGENT is sent to remotes that advertise the agent capability.
+const AGENT = "git/codecrafters-go"
+
+// Capabilities are the capabilities a remote advertises after the NUL on
+// its first ref line, keyed by name. A capability may be advertised more
+// than once, as symref is, and has no values when it takes no argument.
+type Capabilities map[string][]string
+
+// ParseCapabilities parses a space separated capability list.
+func ParseCapabilities(list string) Capabilities {
+	capabilities := Capabilities{}
+	for _, capability := range strings.Fields(list) {
+		name, value, ok := strings.Cut(capability, "=")
+		if !ok {
+			if _, seen := capabilities[name]; !seen {
+				capabilities[name] = nil
+			}
+			continue
+		}
+		capabilities[name] = append(capabilities[name], value)
+	}
+	return capabilities
+}
+
+func (c Capabilities) Has(name string) bool {
+	_, ok := c[name]
+	return ok
+}
+
+// Get returns the first value of a capability.
+func (c Capabilities) Get(name string) (string, bool) {
+	if len(c[name]) == 0 {
+		return "", false
+	}
+	return c[name][0], true
+}
+
+// SymRef returns the target of a symref=<name>:<target> capability.
+func (c Capabilities) SymRef(name string) (string, bool) {
+	for _, value := range c["symref"] {
+		if source, target, ok := strings.Cut(value, ":"); ok && source == name {
+			return target, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// ErrUnsupportedProtocol is returned for URLs whose scheme no transport
+// handles.
+var ErrUnsupportedProtocol = errors.New("unsupported protocol")
+
+// ErrHungUp is returned when a stream ends before the remote has sent
+// its ref advertisement, typically because the command at the other end
+// failed and explained why on its standard error.
+var ErrHungUp = errors.New("the remote end hung up unexpectedly")
+
+// ConnectOptions control how a remote is reached.
+type ConnectOptions struct {
+	// SSHCommand is run to reach ssh URLs, as core.sshCommand is. The
+	// GIT_SSH_COMMAND environment variable takes precedence, and GIT_SSH
+	// and then plain ssh are used when neither is set.
+	SSHCommand string
+}
+
+// connection carries the exchanges of a Remote with the services of one
+// repository. Over smart HTTP each exchange is a separate, stateless
+// request; over a stream the requests and responses of a single session
+// follow each other. Response bodies must be closed by the caller.
+type connection interface {
+	// advertise returns the ref advertisement of service, or its protocol
+	// v2 capabilities.
+	advertise(service string, version int) (io.ReadCloser, error)
+	// request sends one request to service and returns the response.
+	request(service string, version int, body io.Reader) (io.ReadCloser, error)
+	// stateless reports whether the service forgets everything between
+	// requests, so that each must repeat what the last one said.
+	stateless() bool
+	close() error
+}
+
+// dial picks the connection for url: smart HTTP for http:// and https://
+// URLs, a TCP connection to git daemon for git:// URLs, a command's
+// standard input and output for ssh and ext:: URLs, and the in-process
+// server for file:// URLs and local paths.
+func dial(url string, options ConnectOptions) (connection, error) {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return httpConnection{url: url}, nil
+	}
+	if strings.HasPrefix(url, "git://") {
+		open, err := daemonCommand(url)
+		if err != nil {
+			return nil, err
+		}
+		return &streamConnection{open: open}, nil
+	}
+	if command, ok := strings.CutPrefix(url, "ext::"); ok {
+		return &streamConnection{open: extCommand(command)}, nil
+	}
+	if address, ok := parseSSHURL(url); ok {
+		return &streamConnection{open: sshCommand(address, options)}, nil
+	}
+	if path, ok := LocalPath(url); ok {
+		return localConnection{path: path}, nil
+	}
+	scheme, _, _ := strings.Cut(url, "://")
+	return nil, fmt.Errorf("%w '%s'", ErrUnsupportedProtocol, scheme)
+}
+
+// discover reads the ref advertisement of service up to its flush,
+// without the "# service=..." announcement that precedes it over HTTP. An
+// "ERR <message>" line is returned as a *RemoteError.
+func discover(conn connection, service string, version int) ([][]byte, error) {
+	body, err := conn.advertise(service, version)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	reader := bufio.NewReader(body)
+
+	pktLines := [][]byte{}
+	announcement := false
+	for {
+		special, pktLine, err := pktline.ReadPacket(reader)
+		if errors.Is(err, io.EOF) && !conn.stateless() {
+			return nil, ErrHungUp
+		}
+		if err != nil {
+			return nil, err
+		}
+		pktLine = bytes.TrimSuffix(pktLine, []byte("\n"))
+		switch {
+		case special == pktline.FLUSH && announcement:
+			announcement = false
+		case special != "":
+			return pktLines, nil
+		case len(pktLines) == 0 && len(pktLine) > 0 && pktLine[0] == '#':
+			announcement = true
+		case strings.HasPrefix(string(pktLine), "ERR "):
+			return nil, &RemoteError{Message: strings.TrimPrefix(string(pktLine), "ERR ")}
+		default:
+			pktLines = append(pktLines, pktLine)
+		}
+	}
+}
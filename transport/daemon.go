@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// DEFAULT_DAEMON_PORT is where git daemon listens unless a git:// URL
+// names another port.
+const DEFAULT_DAEMON_PORT = "9418"
+
+// daemonCommand returns how to start service for a git://host[:port]/path
+// URL: a TCP connection to git daemon, opened with a request line naming
+// the service, the path and the host, and the protocol version as an extra
+// parameter.
+func daemonCommand(url string) (func(string, int) (io.ReadWriteCloser, error), error) {
+	host, path, _ := strings.Cut(strings.TrimPrefix(url, "git://"), "/")
+	if host == "" {
+		return nil, fmt.Errorf("no host in %s", url)
+	}
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		address = net.JoinHostPort(strings.Trim(host, "[]"), DEFAULT_DAEMON_PORT)
+	}
+	return func(service string, version int) (io.ReadWriteCloser, error) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		request := fmt.Sprintf("%s /%s\x00host=%s\x00", service, path, host)
+		if version == 2 {
+			request += "\x00version=2\x00"
+		}
+		if _, err := io.WriteString(conn, pktline.Encode(request)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}, nil
+}
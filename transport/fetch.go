@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// INFINITE_DEPTH is the depth sent to deepen a shallow history back to its
+// roots.
+const INFINITE_DEPTH = 0x7fffffff
+
+// ErrShallowUnsupported is returned when a shallow fetch is requested from a
+// remote that does not advertise support for it.
+var ErrShallowUnsupported = errors.New("server does not support shallow clients")
+
+// ErrFilterUnsupported is returned when a filtered fetch is requested from a
+// remote that does not advertise the filter capability.
+var ErrFilterUnsupported = errors.New("server does not support filters")
+
+// FetchRequest describes the pack to ask a remote for.
+type FetchRequest struct {
+	Wants []string
+	// Shallow lists the commits the local history currently stops at.
+	Shallow []string
+	// Depth, DeepenSince and DeepenNot limit the history that is sent.
+	// They are unset for a full fetch.
+	Depth       int
+	DeepenSince time.Time
+	DeepenNot   []string
+	// Filter is a partial clone filter-spec such as "blob:none".
+	Filter string
+	// Haves offers local commits so that the remote can leave out what
+	// is already here, and send a thin pack. It is nil for a clone.
+	Haves Negotiator
+}
+
+func (request FetchRequest) deepens() bool {
+	return request.Depth > 0 || !request.DeepenSince.IsZero() || len(request.DeepenNot) > 0
+}
+
+// arguments returns the shallow, deepen and filter lines of a request,
+// which are the same in protocol v0 and v2.
+func (request FetchRequest) arguments() []string {
+	arguments := []string{}
+	for _, commit := range request.Shallow {
+		arguments = append(arguments, "shallow "+commit)
+	}
+	if request.Depth > 0 {
+		arguments = append(arguments, fmt.Sprintf("deepen %d", request.Depth))
+	}
+	if !request.DeepenSince.IsZero() {
+		arguments = append(arguments, fmt.Sprintf("deepen-since %d", request.DeepenSince.Unix()))
+	}
+	for _, ref := range request.DeepenNot {
+		arguments = append(arguments, "deepen-not "+ref)
+	}
+	if request.Filter != "" {
+		arguments = append(arguments, "filter "+request.Filter)
+	}
+	return arguments
+}
+
+// FetchResponse is a pack as it arrives from the remote, along with the
+// changes to the local shallow boundary the remote reported.
+type FetchResponse struct {
+	Pack io.ReadCloser
+	// Shallow lists commits whose parents were not sent, and Unshallow
+	// previously shallow commits whose parents now were.
+	Shallow   []string
+	Unshallow []string
+}
+
+// parseShallowLine records a "shallow <oid>" or "unshallow <oid>" line, and
+// reports whether line was one.
+func (response *FetchResponse) parseShallowLine(line string) bool {
+	line = strings.TrimSuffix(line, "\n")
+	if commit, ok := strings.CutPrefix(line, "shallow "); ok {
+		response.Shallow = append(response.Shallow, commit)
+		return true
+	}
+	if commit, ok := strings.CutPrefix(line, "unshallow "); ok {
+		response.Unshallow = append(response.Unshallow, commit)
+		return true
+	}
+	return false
+}
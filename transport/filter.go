@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter is a parsed partial clone filter-spec. The zero Filter leaves
+// nothing out.
+type Filter struct {
+	// LimitBlobs leaves out blobs of BlobLimit bytes or more; blob:none
+	// is a limit of 0.
+	LimitBlobs bool
+	BlobLimit  uint64
+	// LimitDepth leaves out trees and blobs TreeDepth or more levels
+	// below a commit's root tree, which is at depth 0.
+	LimitDepth bool
+	TreeDepth  uint64
+}
+
+// ParseFilter parses a filter-spec: blob:none, blob:limit=<n>[kmg] or
+// tree:<depth>.
+func ParseFilter(spec string) (Filter, error) {
+	kind, value, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "blob":
+		if value == "none" {
+			return Filter{LimitBlobs: true}, nil
+		}
+		if limit, ok := strings.CutPrefix(value, "limit="); ok {
+			unit := uint64(1)
+			switch {
+			case strings.HasSuffix(strings.ToLower(limit), "k"):
+				unit = 1 << 10
+			case strings.HasSuffix(strings.ToLower(limit), "m"):
+				unit = 1 << 20
+			case strings.HasSuffix(strings.ToLower(limit), "g"):
+				unit = 1 << 30
+			}
+			if unit > 1 {
+				limit = limit[:len(limit)-1]
+			}
+			if size, err := strconv.ParseUint(limit, 10, 64); err == nil {
+				return Filter{LimitBlobs: true, BlobLimit: size * unit}, nil
+			}
+		}
+	case "tree":
+		if depth, err := strconv.ParseUint(value, 10, 64); err == nil {
+			return Filter{LimitDepth: true, TreeDepth: depth}, nil
+		}
+	}
+	return Filter{}, fmt.Errorf("invalid filter-spec '%s'", spec)
+}
+
+// CheckFilter validates a partial clone filter-spec.
+func CheckFilter(spec string) error {
+	_, err := ParseFilter(spec)
+	return err
+}
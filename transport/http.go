@@ -0,0 +1,377 @@
+// Package transport talks to remote repositories over git's smart HTTP
+// protocol, the git:// daemon protocol, the standard input and output of
+// ssh or another command, or to repositories on disk through an in-process
+// server.
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// ZERO_ID is advertised in place of a ref by a remote with no refs, as
+// "0000...0000 capabilities^{}".
+const ZERO_ID = "0000000000000000000000000000000000000000"
+
+// POST_BUFFER_SIZE is the largest request body sent with a Content-Length,
+// like git's http.postBuffer. Larger bodies are streamed with chunked
+// transfer encoding, which not every server accepts.
+const POST_BUFFER_SIZE = 1 << 20
+
+// ErrUnsupportedObjectFormat is returned for remotes that do not use SHA-1
+// object names.
+var ErrUnsupportedObjectFormat = errors.New("unsupported object format")
+
+// RemoteError is a fatal error the remote reported on side-band channel 3.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Message
+}
+
+// Ref is a ref advertised by a remote. Hash is empty for an unborn HEAD.
+type Ref struct {
+	Name string
+	Hash string
+	// Target is the ref a symbolic ref such as HEAD points at, when the
+	// remote reports it.
+	Target string
+}
+
+// Remote is the upload-pack or receive-pack service of a repository,
+// reached over smart HTTP or a stream, or served in-process. Connect decides which protocol version is spoken.
+type Remote struct {
+	URL          string
+	Version      int
+	Capabilities Capabilities
+	// Progress receives the progress messages the remote sends while it
+	// prepares a pack. No progress is requested when it is nil.
+	Progress io.Writer
+	// refs is the protocol v0 ref advertisement; v2 remotes list refs on
+	// request instead.
+	refs []Ref
+	conn connection
+}
+
+func protocolError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", pktline.ErrProtocol, fmt.Sprintf(format, args...))
+}
+
+func checkResponse(response *http.Response) error {
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return protocolError("unexpected HTTP status %s from %s", response.Status, response.Request.URL)
+	}
+	return nil
+}
+
+func checkObjectFormat(capabilities Capabilities) error {
+	if format, ok := capabilities.Get("object-format"); ok && format != "sha1" {
+		return fmt.Errorf("%w: %s", ErrUnsupportedObjectFormat, format)
+	}
+	return nil
+}
+
+// parseRefs decodes the ref advertisement that follows the service
+// announcement, along with the capabilities on its first line. Peeled tag
+// entries ("<tag>^{}") are dropped.
+func parseRefs(pktLines [][]byte) ([]Ref, Capabilities, error) {
+	refs := []Ref{}
+	var capabilities Capabilities
+	for _, pktLine := range pktLines {
+		if len(pktLine) == 0 || pktLine[0] == '#' {
+			continue
+		}
+		line, capabilityList, hasCapabilities := bytes.Cut(pktLine, []byte{0})
+		if capabilities == nil && hasCapabilities {
+			capabilities = ParseCapabilities(string(capabilityList))
+		}
+		hash, name, ok := strings.Cut(string(line), " ")
+		if !ok || !object.IsName(hash) {
+			return nil, nil, protocolError("bad ref advertisement %q", pktLine)
+		}
+		if hash == ZERO_ID || strings.HasSuffix(name, "^{}") {
+			continue
+		}
+		refs = append(refs, Ref{Name: name, Hash: hash})
+	}
+	if capabilities == nil {
+		capabilities = Capabilities{}
+	}
+	if target, ok := capabilities.SymRef("HEAD"); ok {
+		for i := range refs {
+			if refs[i].Name == "HEAD" {
+				refs[i].Target = target
+			}
+		}
+	}
+	return refs, capabilities, checkObjectFormat(capabilities)
+}
+
+// httpConnection reaches a repository over smart HTTP: GET
+// <url>/info/refs for the ref advertisement, and a POST to <url>/<service>
+// for each request.
+type httpConnection struct {
+	url string
+}
+
+func (c httpConnection) advertise(service string, version int) (io.ReadCloser, error) {
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/info/refs?service=%s", c.url, service), nil)
+	if err != nil {
+		return nil, err
+	}
+	if version == 2 {
+		request.Header.Set("Git-Protocol", "version=2")
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(response); err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+func (c httpConnection) stateless() bool {
+	return true
+}
+
+func (c httpConnection) close() error {
+	return nil
+}
+
+// request sends body to service. Bodies up to POST_BUFFER_SIZE go with a
+// Content-Length.
+func (c httpConnection) request(service string, version int, request io.Reader) (io.ReadCloser, error) {
+	buffered := &bytes.Buffer{}
+	if _, err := io.CopyN(buffered, request, POST_BUFFER_SIZE+1); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	body := io.Reader(bytes.NewReader(buffered.Bytes()))
+	if buffered.Len() > POST_BUFFER_SIZE {
+		body = io.MultiReader(body, request)
+	}
+	httpRequest, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s", c.url, service), body)
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", fmt.Sprintf("application/x-%s-request", service))
+	if version == 2 {
+		httpRequest.Header.Set("Git-Protocol", "version=2")
+	}
+	response, err := http.DefaultClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(response); err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// Connect fetches the ref advertisement of the upload-pack service at url,
+// asking for protocol v2 and falling back to v0 when the server ignores
+// the request.
+func Connect(url string, options ConnectOptions) (*Remote, error) {
+	conn, err := dial(url, options)
+	if err != nil {
+		return nil, err
+	}
+	pktLines, err := discover(conn, "git-upload-pack", 2)
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	remote := &Remote{URL: url, conn: conn}
+	if len(pktLines) > 0 && string(pktLines[0]) == "version 2" {
+		remote.Version = 2
+		remote.Capabilities = parseV2Capabilities(pktLines[1:])
+		if err := checkObjectFormat(remote.Capabilities); err != nil {
+			conn.close()
+			return nil, err
+		}
+		return remote, nil
+	}
+	if len(pktLines) > 0 && string(pktLines[0]) == "version 1" {
+		pktLines = pktLines[1:]
+	}
+	remote.refs, remote.Capabilities, err = parseRefs(pktLines)
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// Close ends the session with the remote, for transports that hold one
+// open.
+func (r *Remote) Close() error {
+	return r.conn.close()
+}
+
+// ListRefs returns the remote's refs that equal or start with one of
+// prefixes, in the order the remote sent them. Protocol v2 remotes filter
+// the list themselves.
+func (r *Remote) ListRefs(prefixes []string) ([]Ref, error) {
+	if r.Version == 2 {
+		return r.lsRefs(prefixes)
+	}
+
+	refs := []Ref{}
+	for _, ref := range r.refs {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(ref.Name, prefix) {
+				refs = append(refs, ref)
+				break
+			}
+		}
+	}
+	return refs, nil
+}
+
+// post sends a request to service and returns the response body, which the
+// caller must close.
+func (r *Remote) post(service string, request io.Reader) (io.ReadCloser, error) {
+	return r.conn.request(service, r.Version, request)
+}
+
+// requestCapabilities returns the capabilities sent with the first want,
+// limited to those the remote advertised and request needs.
+func (r *Remote) requestCapabilities(request FetchRequest) string {
+	capabilities := r.Capabilities
+	requested := ""
+	if capabilities.Has("side-band-64k") {
+		requested += " side-band-64k"
+	} else if capabilities.Has("side-band") {
+		requested += " side-band"
+	}
+	if r.Progress == nil && capabilities.Has("no-progress") {
+		requested += " no-progress"
+	}
+	if capabilities.Has("ofs-delta") {
+		requested += " ofs-delta"
+	}
+	if request.Haves != nil && capabilities.Has("multi_ack_detailed") {
+		requested += " multi_ack_detailed"
+		if capabilities.Has("no-done") {
+			requested += " no-done"
+		}
+	}
+	if request.Haves != nil && capabilities.Has("thin-pack") {
+		requested += " thin-pack"
+	}
+	if request.Filter != "" {
+		requested += " filter"
+	}
+	if capabilities.Has("agent") {
+		requested += " agent=" + AGENT
+	}
+	return requested
+}
+
+// packStream is the pack in an upload-pack response, closing the response
+// body when closed.
+type packStream struct {
+	io.Reader
+	io.Closer
+}
+
+// FetchPack requests a pack containing the wants of request and everything
+// reachable from them, and returns the pack as it arrives. The caller must
+// close the pack.
+func (r *Remote) FetchPack(request FetchRequest) (*FetchResponse, error) {
+	if r.Version == 2 {
+		return r.fetchV2(request)
+	}
+	if request.Depth > 0 && !r.Capabilities.Has("shallow") ||
+		!request.DeepenSince.IsZero() && !r.Capabilities.Has("deepen-since") ||
+		len(request.DeepenNot) > 0 && !r.Capabilities.Has("deepen-not") {
+		return nil, ErrShallowUnsupported
+	}
+	if request.Filter != "" && !r.Capabilities.Has("filter") {
+		return nil, ErrFilterUnsupported
+	}
+
+	wants := ""
+	for i, want := range request.Wants {
+		if i == 0 {
+			wants += pktline.Encode(fmt.Sprintf("want %s%s\n", want, r.requestCapabilities(request)))
+		} else {
+			wants += pktline.Encode(fmt.Sprintf("want %s\n", want))
+		}
+	}
+	for _, argument := range request.arguments() {
+		wants += pktline.Encode(argument + "\n")
+	}
+	wants += pktline.FLUSH
+
+	// Negotiation needs multi_ack_detailed, without which a stateless
+	// remote cannot say when a round is over; otherwise no haves are sent.
+	// Over a stream the wants are only sent once, and each have too.
+	negotiation := newNegotiation(nil)
+	if r.Capabilities.Has("multi_ack_detailed") {
+		negotiation = newNegotiation(request.Haves)
+	}
+	stateless := r.conn.stateless()
+	negotiation.stateful = !stateless
+	noDone := r.Capabilities.Has("no-done")
+	var responseBody io.ReadCloser
+	var reader *bufio.Reader
+	response := &FetchResponse{}
+	for round := 0; ; round++ {
+		haves, more, err := negotiation.round()
+		if err != nil {
+			return nil, err
+		}
+		body := ""
+		if stateless || round == 0 {
+			body = wants
+		}
+		for _, have := range haves {
+			body += pktline.Encode(fmt.Sprintf("have %s\n", have))
+		}
+		if more {
+			body += pktline.FLUSH
+		} else {
+			body += pktline.Encode("done\n")
+		}
+
+		responseBody, err = r.post("git-upload-pack", strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		// Each stateless response repeats the shallow boundary of a
+		// deepening request; only the one sent with the pack is kept.
+		reader = bufio.NewReader(responseBody)
+		if stateless {
+			response = &FetchResponse{}
+		}
+		packFollows, err := negotiation.readAcknowledgments(reader, response, !more, noDone)
+		if err != nil {
+			responseBody.Close()
+			return nil, err
+		}
+		if packFollows {
+			break
+		}
+		responseBody.Close()
+	}
+
+	if r.Capabilities.Has("side-band-64k") || r.Capabilities.Has("side-band") {
+		response.Pack = packStream{newSideBandReader(reader, r.Progress), responseBody}
+	} else {
+		response.Pack = packStream{reader, responseBody}
+	}
+	return response, nil
+}
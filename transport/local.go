@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotRepository is returned when a local path holds no repository.
+var ErrNotRepository = errors.New("does not appear to be a git repository")
+
+// LocalServer serves one request of service, "git-upload-pack" or
+// "git-receive-pack", for the repository at path, as a smart HTTP server
+// would: with a nil request it writes the ref advertisement, or the
+// protocol v2 capabilities, to response. It returns ErrNotRepository when
+// there is no repository at path.
+type LocalServer func(path, service string, version int, request io.Reader, response io.Writer) error
+
+var localServer LocalServer
+
+// RegisterLocalServer installs the server that answers file:// URLs and
+// local paths. The server package registers its upload-pack and
+// receive-pack when it is imported.
+func RegisterLocalServer(server LocalServer) {
+	localServer = server
+}
+
+// LocalPath returns the path a file:// URL or a plain path names. Like
+// git, it takes "host:path", with no slash before the colon, for an ssh
+// address rather than a path.
+func LocalPath(url string) (string, bool) {
+	if path, ok := strings.CutPrefix(url, "file://"); ok {
+		return path, true
+	}
+	if strings.Contains(url, "://") {
+		return "", false
+	}
+	colon, slash := strings.Index(url, ":"), strings.Index(url, "/")
+	return url, colon < 0 || slash >= 0 && slash < colon
+}
+
+// localConnection reaches a repository on disk through the registered
+// LocalServer, which runs in-process with its response piped back.
+type localConnection struct {
+	path string
+}
+
+func (c localConnection) advertise(service string, version int) (io.ReadCloser, error) {
+	return c.request(service, version, nil)
+}
+
+func (c localConnection) request(service string, version int, body io.Reader) (io.ReadCloser, error) {
+	if localServer == nil {
+		return nil, fmt.Errorf("%w 'file'", ErrUnsupportedProtocol)
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(localServer(c.path, service, version, body, writer))
+	}()
+	return reader, nil
+}
+
+func (c localConnection) stateless() bool {
+	return true
+}
+
+func (c localConnection) close() error {
+	return nil
+}
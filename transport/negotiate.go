@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+const (
+	// INITIAL_HAVES is the number of haves offered in the first round of
+	// negotiation. Each later round offers twice as many as the one before.
+	INITIAL_HAVES = 16
+	// MAX_IN_VAIN is the number of haves offered without the remote
+	// acknowledging any before negotiation gives up and asks for the pack.
+	MAX_IN_VAIN = 256
+)
+
+// Negotiator chooses the local commits offered as haves while negotiating
+// a fetch, and learns which of them the remote also has so that their
+// ancestors need not be offered.
+type Negotiator interface {
+	// Next returns the next commit to offer, and false when there are no
+	// more.
+	Next() (string, bool, error)
+	// Ack records that the remote has commitName.
+	Ack(commitName string)
+}
+
+// negotiation tracks the have/ack exchange of a fetch. Over HTTP every
+// round is a separate request, so the commits found to be in common are
+// sent again in each round along with a new batch; a remote at the other
+// end of a stream remembers them.
+type negotiation struct {
+	haves    Negotiator
+	common   []string
+	isCommon map[string]bool
+	batch    int
+	inVain   int
+	// stateful is set when each round sends only its new batch.
+	stateful bool
+	// ready is set once the remote has found enough in common to send the
+	// pack.
+	ready bool
+}
+
+func newNegotiation(haves Negotiator) *negotiation {
+	return &negotiation{haves: haves, isCommon: map[string]bool{}, batch: INITIAL_HAVES}
+}
+
+// round returns the haves of the next round and true, or the haves to send
+// with "done" and false once negotiation is over.
+func (n *negotiation) round() ([]string, bool, error) {
+	common := n.common[:len(n.common):len(n.common)]
+	if n.stateful {
+		common = nil
+	}
+	if n.haves == nil || n.ready || n.inVain >= MAX_IN_VAIN {
+		return common, false, nil
+	}
+	batch := []string{}
+	for len(batch) < n.batch {
+		commitName, ok, err := n.haves.Next()
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			break
+		}
+		if !n.isCommon[commitName] {
+			batch = append(batch, commitName)
+		}
+	}
+	if len(batch) == 0 {
+		return common, false, nil
+	}
+	n.batch *= 2
+	n.inVain += len(batch)
+	return append(common, batch...), true, nil
+}
+
+func (n *negotiation) ack(commitName string) {
+	if n.isCommon[commitName] {
+		return
+	}
+	n.isCommon[commitName] = true
+	n.common = append(n.common, commitName)
+	n.inVain = 0
+	if n.haves != nil {
+		n.haves.Ack(commitName)
+	}
+}
+
+// readAcknowledgments reads a protocol v0 response with multi_ack_detailed
+// up to the pack, or up to the NAK that ends a round when the pack does not
+// follow. It reports whether the pack follows.
+func (n *negotiation) readAcknowledgments(reader *bufio.Reader, response *FetchResponse, done bool, noDone bool) (bool, error) {
+	for {
+		special, data, err := pktline.ReadPacket(reader)
+		if err != nil {
+			return false, err
+		}
+		line := string(bytes.TrimSuffix(data, []byte("\n")))
+		if special != "" || response.parseShallowLine(line) {
+			continue
+		}
+
+		if line == "NAK" {
+			// With no-done, a remote that is ready follows the NAK with a
+			// final ACK and the pack.
+			if done || !(n.ready && noDone) {
+				return done, nil
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "ACK" {
+			return false, protocolError("expected ACK/NAK, got %q", data)
+		}
+		n.ack(fields[1])
+		if len(fields) == 2 {
+			return true, nil
+		}
+		if fields[2] == "ready" {
+			n.ready = true
+		}
+	}
+}
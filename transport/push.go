@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// ErrAtomicUnsupported is returned when an atomic push is requested from a
+// remote that does not advertise the atomic capability.
+var ErrAtomicUnsupported = errors.New("the receiving end does not support --atomic push")
+
+// ErrDeleteUnsupported is returned when a push deletes a ref on a remote
+// that does not advertise the delete-refs capability.
+var ErrDeleteUnsupported = errors.New("the receiving end does not support deleting refs")
+
+// PushCommand changes one ref on the remote from Old to New. Old is ZERO_ID
+// for a ref that does not exist yet, and New is ZERO_ID to delete the ref.
+type PushCommand struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// PushRequest describes the ref updates to send to receive-pack.
+type PushRequest struct {
+	Commands []PushCommand
+	// Pack holds the objects the remote lacks. It is not read when every
+	// command is a deletion.
+	Pack io.Reader
+	// Atomic asks the remote to update all refs or none of them.
+	Atomic bool
+}
+
+// PushReport is the outcome of a push as reported by the remote.
+type PushReport struct {
+	// Unpack is "ok", or the reason the remote failed to unpack the pack.
+	Unpack string
+	// Rejected maps the refs the remote refused to update to the reason
+	// it gave.
+	Rejected map[string]string
+}
+
+// ConnectPush fetches the ref advertisement of the receive-pack service at
+// url. Pushing always uses protocol v0.
+func ConnectPush(url string, options ConnectOptions) (*Remote, error) {
+	conn, err := dial(url, options)
+	if err != nil {
+		return nil, err
+	}
+	pktLines, err := discover(conn, "git-receive-pack", 0)
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	remote := &Remote{URL: url, conn: conn}
+	remote.refs, remote.Capabilities, err = parseRefs(pktLines)
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// pushCapabilities returns the capabilities sent with the first command.
+func (r *Remote) pushCapabilities(request PushRequest) string {
+	capabilities := r.Capabilities
+	requested := "report-status"
+	if capabilities.Has("side-band-64k") {
+		requested += " side-band-64k"
+	}
+	if r.Progress == nil && capabilities.Has("quiet") {
+		requested += " quiet"
+	}
+	if request.Atomic {
+		requested += " atomic"
+	}
+	if capabilities.Has("agent") {
+		requested += " agent=" + AGENT
+	}
+	return requested
+}
+
+// Push sends the ref update commands of request, followed by the pack when
+// any ref is created or updated, and returns the status the remote
+// reports. With side-band-64k, the remote's progress goes to Progress.
+func (r *Remote) Push(request PushRequest) (*PushReport, error) {
+	if request.Atomic && !r.Capabilities.Has("atomic") {
+		return nil, ErrAtomicUnsupported
+	}
+
+	commands := ""
+	sendPack := false
+	for i, command := range request.Commands {
+		if command.New == ZERO_ID {
+			if !r.Capabilities.Has("delete-refs") {
+				return nil, ErrDeleteUnsupported
+			}
+		} else {
+			sendPack = true
+		}
+		line := fmt.Sprintf("%s %s %s", command.Old, command.New, command.Name)
+		if i == 0 {
+			line += "\x00" + r.pushCapabilities(request)
+		}
+		commands += pktline.Encode(line + "\n")
+	}
+	commands += pktline.FLUSH
+
+	var body io.Reader = strings.NewReader(commands)
+	if sendPack {
+		body = io.MultiReader(body, request.Pack)
+	}
+	responseBody, err := r.post("git-receive-pack", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = bufio.NewReader(responseBody)
+	if r.Capabilities.Has("side-band-64k") {
+		reader = newSideBandReader(reader, r.Progress)
+	}
+	report, err := readPushReport(reader)
+	// Closing the response reports whether the pack was sent in full.
+	if closeErr := responseBody.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// readPushReport parses a report-status response: "unpack <status>", then
+// "ok <ref>" or "ng <ref> <reason>" for each command, then a flush.
+func readPushReport(reader io.Reader) (*PushReport, error) {
+	report := &PushReport{Rejected: map[string]string{}}
+	for {
+		special, data, err := pktline.ReadPacket(reader)
+		if err != nil {
+			return nil, err
+		}
+		if special != "" {
+			break
+		}
+		line := strings.TrimSuffix(string(data), "\n")
+		if status, ok := strings.CutPrefix(line, "unpack "); ok {
+			report.Unpack = status
+		} else if strings.HasPrefix(line, "ok ") {
+			continue
+		} else if rejected, ok := strings.CutPrefix(line, "ng "); ok {
+			name, reason, _ := strings.Cut(rejected, " ")
+			report.Rejected[name] = reason
+		} else {
+			return nil, protocolError("bad report-status line %q", data)
+		}
+	}
+	if report.Unpack == "" {
+		return nil, protocolError("report-status has no unpack status")
+	}
+	return report, nil
+}
@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// remoteProgress prefixes each line the remote writes on the progress
+// channel with "remote: ", as git does. Lines end with either \r or \n and
+// may be split across packets.
+type remoteProgress struct {
+	writer  io.Writer
+	midLine bool
+}
+
+func (p *remoteProgress) Write(message []byte) (int, error) {
+	written := len(message)
+	for len(message) > 0 {
+		end := bytes.IndexAny(message, "\r\n") + 1
+		if end == 0 {
+			end = len(message)
+		}
+		line := message[:end]
+		if !p.midLine {
+			line = append([]byte("remote: "), line...)
+		}
+		if _, err := p.writer.Write(line); err != nil {
+			return 0, err
+		}
+		p.midLine = message[end-1] != '\r' && message[end-1] != '\n'
+		message = message[end:]
+	}
+	return written, nil
+}
+
+// sideBandReader reads the data sent on side-band channel 1 up to the
+// flush, one packet at a time. Progress on channel 2 goes to progress, when
+// it is set, and a message on channel 3 is returned as a *RemoteError.
+type sideBandReader struct {
+	reader   io.Reader
+	progress *remoteProgress
+	pending  []byte
+	done     bool
+}
+
+func newSideBandReader(reader io.Reader, progress io.Writer) *sideBandReader {
+	sideBand := &sideBandReader{reader: reader}
+	if progress != nil {
+		sideBand.progress = &remoteProgress{writer: progress}
+	}
+	return sideBand
+}
+
+func (s *sideBandReader) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *sideBandReader) next() error {
+	special, data, err := pktline.ReadPacket(s.reader)
+	if errors.Is(err, io.EOF) {
+		return protocolError("side-band stream ended without a flush")
+	}
+	if err != nil {
+		return err
+	}
+	if special != "" {
+		s.done = true
+		return nil
+	}
+	if len(data) == 0 {
+		return protocolError("empty side-band packet")
+	}
+
+	switch data[0] {
+	case 1:
+		s.pending = data[1:]
+	case 2:
+		if s.progress != nil {
+			s.progress.Write(data[1:])
+		}
+	case 3:
+		return &RemoteError{Message: strings.TrimSpace(string(data[1:]))}
+	default:
+		return protocolError("bad side-band channel %d", data[0])
+	}
+	return nil
+}
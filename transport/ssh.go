@@ -0,0 +1,174 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPortUnsupported is returned for an ssh URL with a port when the ssh
+// command is not known to be OpenSSH, which is the only one told the port.
+var ErrPortUnsupported = errors.New("ssh variant 'simple' does not support setting port")
+
+// sshAddress is where an ssh URL points: a host, with an optional user
+// and port, and the path of the repository there.
+type sshAddress struct {
+	host string
+	port string
+	path string
+}
+
+// parseSSHURL splits ssh://[user@]host[:port]/path URLs, and the scp-like
+// [user@]host:path, which has no slash before the colon. A path starting
+// with "/~" in a URL is taken relative to a home directory, as in git.
+func parseSSHURL(url string) (sshAddress, bool) {
+	for _, scheme := range []string{"ssh://", "git+ssh://", "ssh+git://"} {
+		rest, ok := strings.CutPrefix(url, scheme)
+		if !ok {
+			continue
+		}
+		hostPort, path, _ := strings.Cut(rest, "/")
+		address := sshAddress{host: hostPort, path: "/" + path}
+		if strings.HasPrefix(address.path, "/~") {
+			address.path = address.path[1:]
+		}
+		user, host, hasUser := strings.Cut(hostPort, "@")
+		if !hasUser {
+			user, host = "", hostPort
+		}
+		if bracketed, ok := strings.CutPrefix(host, "["); ok {
+			host, port, _ := strings.Cut(bracketed, "]")
+			address.host, address.port = host, strings.TrimPrefix(port, ":")
+		} else if name, port, ok := strings.Cut(host, ":"); ok {
+			address.host, address.port = name, port
+		} else {
+			address.host = host
+		}
+		if hasUser {
+			address.host = user + "@" + address.host
+		}
+		return address, address.host != ""
+	}
+
+	if strings.Contains(url, "://") {
+		return sshAddress{}, false
+	}
+	colon, slash := strings.Index(url, ":"), strings.Index(url, "/")
+	if colon <= 0 || slash >= 0 && slash < colon {
+		return sshAddress{}, false
+	}
+	return sshAddress{host: url[:colon], path: url[colon+1:]}, true
+}
+
+// shellQuote quotes s for a POSIX shell, as git does for the path it
+// passes to the remote command.
+func shellQuote(s string) string {
+	s = strings.ReplaceAll(s, "'", `'\''`)
+	s = strings.ReplaceAll(s, "!", `'\!'`)
+	return "'" + s + "'"
+}
+
+// protocolEnvironment returns the environment for a command serving
+// version.
+func protocolEnvironment(version int) []string {
+	environment := os.Environ()
+	if version == 2 {
+		environment = append(environment, "GIT_PROTOCOL=version=2")
+	}
+	return environment
+}
+
+// sshCommand returns how to start service at address: the ssh command is
+// given the host and runs "<service> '<path>'" there. GIT_SSH_COMMAND and
+// core.sshCommand are run by the shell, and GIT_SSH directly. Only OpenSSH
+// is passed the port, and asked to send GIT_PROTOCOL for protocol v2.
+func sshCommand(address sshAddress, options ConnectOptions) func(string, int) (io.ReadWriteCloser, error) {
+	return func(service string, version int) (io.ReadWriteCloser, error) {
+		program, shell := os.Getenv("GIT_SSH_COMMAND"), true
+		if program == "" {
+			program = options.SSHCommand
+		}
+		if program == "" {
+			program, shell = os.Getenv("GIT_SSH"), false
+		}
+		if program == "" {
+			program, shell = "ssh", false
+		}
+
+		name := program
+		if fields := strings.Fields(program); shell && len(fields) > 0 {
+			name = fields[0]
+		}
+		openSSH := strings.TrimSuffix(filepath.Base(name), ".exe") == "ssh"
+
+		arguments := []string{}
+		if openSSH && version == 2 {
+			arguments = append(arguments, "-o", "SendEnv=GIT_PROTOCOL")
+		}
+		if address.port != "" {
+			if !openSSH {
+				return nil, ErrPortUnsupported
+			}
+			arguments = append(arguments, "-p", address.port)
+		}
+		arguments = append(arguments, address.host, fmt.Sprintf("%s %s", service, shellQuote(address.path)))
+
+		var command *exec.Cmd
+		if shell {
+			command = exec.Command("sh", append([]string{"-c", program + ` "$@"`, program}, arguments...)...)
+		} else {
+			command = exec.Command(program, arguments...)
+		}
+		command.Env = protocolEnvironment(version)
+		return startCommand(command)
+	}
+}
+
+// extCommand returns how to start service for an "ext::<command>
+// [<argument>...]" URL, which runs the command directly on the local
+// machine. Arguments are split at spaces; "% " is a literal space, "%%" a
+// percent sign, "%S" the service name and "%s" the name without "git-".
+func extCommand(commandLine string) func(string, int) (io.ReadWriteCloser, error) {
+	return func(service string, version int) (io.ReadWriteCloser, error) {
+		arguments := []string{}
+		argument, escaped := strings.Builder{}, false
+		for _, c := range commandLine + " " {
+			switch {
+			case escaped:
+				escaped = false
+				switch c {
+				case 's':
+					argument.WriteString(strings.TrimPrefix(service, "git-"))
+				case 'S':
+					argument.WriteString(service)
+				case ' ', '%':
+					argument.WriteRune(c)
+				default:
+					return nil, fmt.Errorf("bad placeholder %%%c in ext:: command", c)
+				}
+			case c == '%':
+				escaped = true
+			case c == ' ':
+				if argument.Len() > 0 {
+					arguments = append(arguments, argument.String())
+				}
+				argument.Reset()
+			default:
+				argument.WriteRune(c)
+			}
+		}
+		if len(arguments) == 0 {
+			return nil, errors.New("ext:: command is empty")
+		}
+
+		command := exec.Command(arguments[0], arguments[1:]...)
+		command.Env = append(protocolEnvironment(version),
+			"GIT_EXT_SERVICE="+service,
+			"GIT_EXT_SERVICE_NOPREFIX="+strings.TrimPrefix(service, "git-"))
+		return startCommand(command)
+	}
+}
@@ -0,0 +1,143 @@
+package transport
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// streamConnection holds one session with a service over a bidirectional
+// stream, such as the standard input and output of ssh. The stream is
+// opened by advertise, whose response is the service's opening ref
+// advertisement; each request is then written to the stream and answered
+// on it in turn. Responses are read straight from the stream, so they
+// must be read to their end before the next request.
+type streamConnection struct {
+	open   func(service string, version int) (io.ReadWriteCloser, error)
+	stream io.ReadWriteCloser
+	reader *bufio.Reader
+	// written receives the result of writing the last request, while it
+	// has not been waited for.
+	written chan error
+}
+
+func (c *streamConnection) advertise(service string, version int) (io.ReadCloser, error) {
+	if c.stream != nil {
+		return nil, errors.New("stream already open")
+	}
+	stream, err := c.open(service, version)
+	if err != nil {
+		return nil, err
+	}
+	c.stream, c.reader = stream, bufio.NewReader(stream)
+	return io.NopCloser(c.reader), nil
+}
+
+// request writes body while the response is read, since a remote may
+// answer, with progress for example, before it has read everything.
+// Closing the response waits for body to be written, and returns the error
+// writing it, such as one from reading body.
+func (c *streamConnection) request(service string, version int, body io.Reader) (io.ReadCloser, error) {
+	if c.stream == nil {
+		return nil, errors.New("stream is not open")
+	}
+	if err := c.waitWritten(); err != nil {
+		return nil, err
+	}
+	written := make(chan error, 1)
+	c.written = written
+	go func() {
+		_, err := io.Copy(c.stream, body)
+		written <- err
+	}()
+	return streamResponse{c}, nil
+}
+
+// waitWritten waits until the last request has been written, and returns
+// the error writing it.
+func (c *streamConnection) waitWritten() error {
+	if c.written == nil {
+		return nil
+	}
+	err := <-c.written
+	c.written = nil
+	return err
+}
+
+// streamResponse is the response to a request on a stream, which leaves
+// the stream open when closed.
+type streamResponse struct {
+	conn *streamConnection
+}
+
+func (r streamResponse) Read(p []byte) (int, error) {
+	return r.conn.reader.Read(p)
+}
+
+func (r streamResponse) Close() error {
+	return r.conn.waitWritten()
+}
+
+func (c *streamConnection) stateless() bool {
+	return false
+}
+
+// close ends the session with a flush, which the remote may no longer be
+// reading, and closes the stream. A request still being written is cut
+// short.
+func (c *streamConnection) close() error {
+	if c.stream == nil {
+		return nil
+	}
+	if c.written == nil {
+		io.WriteString(c.stream, pktline.FLUSH)
+	}
+	err := c.stream.Close()
+	c.waitWritten()
+	c.stream = nil
+	return err
+}
+
+// commandStream is a running command seen as a stream: writes go to its
+// standard input and reads come from its standard output. Its standard
+// error is passed through, so that the user sees why it failed.
+type commandStream struct {
+	command *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  io.ReadCloser
+}
+
+func startCommand(command *exec.Cmd) (*commandStream, error) {
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	command.Stderr = os.Stderr
+	if err := command.Start(); err != nil {
+		return nil, err
+	}
+	return &commandStream{command: command, stdin: stdin, stdout: stdout}, nil
+}
+
+func (s *commandStream) Read(p []byte) (int, error) {
+	return s.stdout.Read(p)
+}
+
+func (s *commandStream) Write(p []byte) (int, error) {
+	return s.stdin.Write(p)
+}
+
+// Close closes the command's input and output and waits for it to exit.
+func (s *commandStream) Close() error {
+	s.stdin.Close()
+	s.stdout.Close()
+	return s.command.Wait()
+}
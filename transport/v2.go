@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// parseV2Capabilities parses the capability advertisement that follows
+// "version 2", one "<name>[=<value>]" per line up to the flush.
+func parseV2Capabilities(pktLines [][]byte) Capabilities {
+	capabilities := Capabilities{}
+	for _, pktLine := range pktLines {
+		if len(pktLine) == 0 {
+			break
+		}
+		name, value, ok := strings.Cut(string(pktLine), "=")
+		if !ok {
+			capabilities[name] = nil
+			continue
+		}
+		capabilities[name] = append(capabilities[name], value)
+	}
+	return capabilities
+}
+
+// command sends a protocol v2 command with its arguments and returns the
+// response body, which the caller must close.
+func (r *Remote) command(name string, arguments []string) (io.ReadCloser, error) {
+	if !r.Capabilities.Has(name) {
+		return nil, protocolError("server does not support the %s command", name)
+	}
+
+	request := pktline.Encode(fmt.Sprintf("command=%s\n", name))
+	if r.Capabilities.Has("agent") {
+		request += pktline.Encode(fmt.Sprintf("agent=%s\n", AGENT))
+	}
+	if r.Capabilities.Has("object-format") {
+		request += pktline.Encode("object-format=sha1\n")
+	}
+	request += pktline.DELIM
+	for _, argument := range arguments {
+		request += pktline.Encode(argument + "\n")
+	}
+	request += pktline.FLUSH
+	return r.post("git-upload-pack", strings.NewReader(request))
+}
+
+// lsRefs runs the ls-refs command, asking only for refs under prefixes.
+func (r *Remote) lsRefs(prefixes []string) ([]Ref, error) {
+	arguments := []string{"symrefs"}
+	lsRefsFeatures, _ := r.Capabilities.Get("ls-refs")
+	if strings.Contains(" "+lsRefsFeatures+" ", " unborn ") {
+		arguments = append(arguments, "unborn")
+	}
+	for _, prefix := range prefixes {
+		arguments = append(arguments, "ref-prefix "+prefix)
+	}
+
+	body, err := r.command("ls-refs", arguments)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	reader := bufio.NewReader(body)
+
+	refs := []Ref{}
+	for {
+		special, pktLine, err := pktline.ReadPacket(reader)
+		if err != nil {
+			return nil, err
+		}
+		if special != "" {
+			return refs, nil
+		}
+		fields := strings.Split(strings.TrimSuffix(string(pktLine), "\n"), " ")
+		if len(fields) < 2 {
+			return nil, protocolError("bad ls-refs line %q", pktLine)
+		}
+		ref := Ref{Hash: fields[0], Name: fields[1]}
+		if ref.Hash == "unborn" {
+			ref.Hash = ""
+		}
+		for _, attribute := range fields[2:] {
+			if target, ok := strings.CutPrefix(attribute, "symref-target:"); ok {
+				ref.Target = target
+			}
+		}
+		refs = append(refs, ref)
+	}
+}
+
+// fetchV2 runs the fetch command, once per round of negotiation, and
+// returns the pack from the packfile section of the last response.
+func (r *Remote) fetchV2(request FetchRequest) (*FetchResponse, error) {
+	fetchFeatures, _ := r.Capabilities.Get("fetch")
+	if request.deepens() && !strings.Contains(" "+fetchFeatures+" ", " shallow ") {
+		return nil, ErrShallowUnsupported
+	}
+	if request.Filter != "" && !strings.Contains(" "+fetchFeatures+" ", " filter ") {
+		return nil, ErrFilterUnsupported
+	}
+
+	arguments := []string{"ofs-delta"}
+	if request.Haves != nil {
+		arguments = append(arguments, "thin-pack")
+	}
+	if r.Progress == nil {
+		arguments = append(arguments, "no-progress")
+	}
+	for _, want := range request.Wants {
+		arguments = append(arguments, "want "+want)
+	}
+	arguments = append(arguments, request.arguments()...)
+
+	negotiation := newNegotiation(request.Haves)
+	for {
+		haves, more, err := negotiation.round()
+		if err != nil {
+			return nil, err
+		}
+		roundArguments := arguments[:len(arguments):len(arguments)]
+		for _, have := range haves {
+			roundArguments = append(roundArguments, "have "+have)
+		}
+		if !more {
+			roundArguments = append(roundArguments, "done")
+		}
+
+		body, err := r.command("fetch", roundArguments)
+		if err != nil {
+			return nil, err
+		}
+		response, err := r.readFetchResponse(body, negotiation)
+		if err != nil || response != nil {
+			return response, err
+		}
+		if !more {
+			return nil, protocolError("fetch response has no packfile section")
+		}
+	}
+}
+
+// readFetchResponse reads the sections of a fetch response, such as
+// acknowledgments and shallow-info, up to the packfile section, which runs
+// to the end of the response. It returns nil, and closes body, when a
+// round of negotiation ends without a pack.
+func (r *Remote) readFetchResponse(body io.ReadCloser, negotiation *negotiation) (*FetchResponse, error) {
+	reader := bufio.NewReader(body)
+	response := &FetchResponse{}
+	section := ""
+	for {
+		special, data, err := pktline.ReadPacket(reader)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		line := strings.TrimSuffix(string(data), "\n")
+
+		switch {
+		case special == pktline.DELIM:
+			section = ""
+		case special != "":
+			body.Close()
+			return nil, nil
+		case section == "" && line == "packfile":
+			response.Pack = packStream{newSideBandReader(reader, r.Progress), body}
+			return response, nil
+		case section == "":
+			section = line
+		case section == "acknowledgments":
+			if commitName, ok := strings.CutPrefix(line, "ACK "); ok {
+				negotiation.ack(commitName)
+			} else if line == "ready" {
+				negotiation.ready = true
+			} else if line != "NAK" {
+				body.Close()
+				return nil, protocolError("bad acknowledgments line %q", data)
+			}
+		case section == "shallow-info":
+			if !response.parseShallowLine(line) {
+				body.Close()
+				return nil, protocolError("bad shallow-info line %q", data)
+			}
+		}
+	}
+}